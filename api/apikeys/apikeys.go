@@ -0,0 +1,226 @@
+// api/apikeys/apikeys.go
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TokenPrefix identifica los personal access tokens en el encabezado Authorization
+const TokenPrefix = "pat_"
+
+// Claim es el claim que AuthMiddleware agrega al token cuando la solicitud se autenticó con una API key
+const Claim = "api_key"
+
+// lastUsedResolution evita escribir lastUsedAt en cada solicitud
+const lastUsedResolution = time.Minute
+
+var (
+	// ErrInvalidKey indica que la API key no existe, no coincide, está revocada o venció
+	ErrInvalidKey = errors.New("API key inválida")
+	// ErrNotFound indica que la API key no existe o pertenece a otro usuario
+	ErrNotFound = errors.New("API key no encontrada")
+)
+
+// Key representa una API key guardada en api_keys/{id}. El secreto solo se guarda como hash SHA-256.
+type Key struct {
+	ID         string     `json:"id" firestore:"-"`
+	UID        string     `json:"-" firestore:"uid"`
+	Name       string     `json:"name" firestore:"name"`
+	Prefix     string     `json:"prefix" firestore:"prefix"`
+	Hash       string     `json:"-" firestore:"hash"`
+	Scopes     []string   `json:"scopes" firestore:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" firestore:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" firestore:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" firestore:"revokedAt,omitempty"`
+}
+
+// Active indica si la API key no está revocada ni vencida
+func (k *Key) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+}
+
+// Store guarda las API keys en Firestore
+type Store struct {
+	client *firestore.Client
+}
+
+// NewStore crea un Store de API keys
+func NewStore(client *firestore.Client) *Store {
+	return &Store{client: client}
+}
+
+func (s *Store) collection() *firestore.CollectionRef {
+	return s.client.Collection("api_keys")
+}
+
+// Create genera una API key para el usuario y devuelve el token completo, que no vuelve a estar disponible.
+// El token tiene la forma pat_<id>_<secreto>; pat_<id> es el prefijo visible.
+func (s *Store) Create(ctx context.Context, uid, name string, scopes []string, expiresAt *time.Time) (*Key, string, error) {
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key := &Key{
+		ID:        id,
+		UID:       uid,
+		Name:      name,
+		Prefix:    TokenPrefix + id,
+		Hash:      hashSecret(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.collection().Doc(id).Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, key.Prefix + "_" + secret, nil
+}
+
+// List devuelve las API keys del usuario
+func (s *Store) List(ctx context.Context, uid string) ([]Key, error) {
+	keys := []Key{}
+	it := s.collection().Where("uid", "==", uid).Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := keyFromDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+}
+
+// Revoke revoca una API key del usuario
+func (s *Store) Revoke(ctx context.Context, uid, id string) error {
+	ref := s.collection().Doc(id)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		key, err := keyFromDoc(doc)
+		if err != nil {
+			return err
+		}
+		if key.UID != uid {
+			return ErrNotFound
+		}
+		if key.RevokedAt != nil {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{{Path: "revokedAt", Value: time.Now()}})
+	})
+}
+
+// DeleteAll elimina todas las API keys del usuario
+func (s *Store) DeleteAll(ctx context.Context, uid string) error {
+	keys, err := s.List(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := s.collection().Doc(key.ID).Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Authenticate valida el token completo y devuelve la API key. La fecha de último uso se registra en
+// segundo plano para no retrasar la solicitud.
+func (s *Store) Authenticate(ctx context.Context, token string) (*Key, error) {
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	doc, err := s.collection().Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := keyFromDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, ErrInvalidKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		go func() {
+			_, err := s.collection().Doc(id).Update(context.Background(), []firestore.Update{{Path: "lastUsedAt", Value: now}})
+			if err != nil {
+				log.Printf("Error al registrar el uso de la API key %s: %v", id, err)
+			}
+		}()
+	}
+	return key, nil
+}
+
+// IsToken indica si el valor tiene el formato de un personal access token
+func IsToken(value string) bool {
+	return strings.HasPrefix(value, TokenPrefix)
+}
+
+// parseToken separa un token pat_<id>_<secreto> en sus partes
+func parseToken(token string) (id, secret string, ok bool) {
+	if !IsToken(token) {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(strings.TrimPrefix(token, TokenPrefix), "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func keyFromDoc(doc *firestore.DocumentSnapshot) (*Key, error) {
+	var key Key
+	if err := doc.DataTo(&key); err != nil {
+		return nil, err
+	}
+	key.ID = doc.Ref.ID
+	return &key, nil
+}
@@ -0,0 +1,192 @@
+// api/approvals/approvals.go
+package approvals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Estados de una solicitud de aprobación
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Estados que la aprobación deja en el campo status de users/{uid}
+const (
+	AccountStatusPendingApproval = "pending_approval"
+	AccountStatusRejected        = "registration_rejected"
+)
+
+var (
+	// ErrNotFound indica que el usuario no tiene una solicitud de aprobación
+	ErrNotFound = errors.New("solicitud de aprobación no encontrada")
+	// ErrNotPending indica que la solicitud ya fue aprobada o rechazada
+	ErrNotPending = errors.New("la solicitud de aprobación ya fue resuelta")
+)
+
+// Approval es la solicitud de aprobación de un registro, guardada en registration_approvals/{uid}
+type Approval struct {
+	UID         string     `json:"uid" firestore:"uid"`
+	Email       string     `json:"email" firestore:"email"`
+	Status      string     `json:"status" firestore:"status"`
+	RequestedAt time.Time  `json:"requestedAt" firestore:"requestedAt"`
+	DecidedAt   *time.Time `json:"decidedAt,omitempty" firestore:"decidedAt"`
+	DecidedBy   string     `json:"decidedBy,omitempty" firestore:"decidedBy"`
+	Reason      string     `json:"reason,omitempty" firestore:"reason"`
+}
+
+// Queue es la cola de registros que esperan la aprobación de un administrador
+type Queue struct {
+	client *firestore.Client
+	// Enabled indica si los registros nuevos requieren aprobación tras verificar el correo
+	Enabled bool
+	// Approvers son los correos a los que se avisa de cada solicitud nueva
+	Approvers []string
+}
+
+// NewQueue crea la cola; con enabled en false solo sirve para resolver solicitudes existentes
+func NewQueue(client *firestore.Client, enabled bool, approvers []string) *Queue {
+	return &Queue{client: client, Enabled: enabled, Approvers: approvers}
+}
+
+// NewQueueFromEnv crea la cola con REGISTRATION_APPROVAL ("true" exige aprobación) y
+// REGISTRATION_APPROVERS (correos separados por comas que reciben el aviso de cada solicitud)
+func NewQueueFromEnv(client *firestore.Client) (*Queue, error) {
+	enabled := false
+	if value := strings.TrimSpace(os.Getenv("REGISTRATION_APPROVAL")); value != "" {
+		var err error
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("REGISTRATION_APPROVAL inválido: %q", value)
+		}
+	}
+
+	var approvers []string
+	for _, email := range strings.Split(os.Getenv("REGISTRATION_APPROVERS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			approvers = append(approvers, email)
+		}
+	}
+	return NewQueue(client, enabled, approvers), nil
+}
+
+func (q *Queue) ref(uid string) *firestore.DocumentRef {
+	return q.client.Collection("registration_approvals").Doc(uid)
+}
+
+// Request agrega el registro a la cola y marca la cuenta como pendiente de aprobación
+func (q *Queue) Request(ctx context.Context, uid, email string) (Approval, error) {
+	approval := Approval{UID: uid, Email: email, Status: StatusPending, RequestedAt: time.Now()}
+
+	batch := q.client.Batch()
+	batch.Set(q.ref(uid), approval)
+	batch.Set(q.client.Collection("users").Doc(uid), map[string]interface{}{
+		"status": AccountStatusPendingApproval,
+	}, firestore.MergeAll)
+	if _, err := batch.Commit(ctx); err != nil {
+		return approval, fmt.Errorf("error al guardar la solicitud de aprobación: %v", err)
+	}
+	return approval, nil
+}
+
+// Get devuelve la solicitud de aprobación del usuario
+func (q *Queue) Get(ctx context.Context, uid string) (Approval, error) {
+	var approval Approval
+	doc, err := q.ref(uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return approval, ErrNotFound
+	}
+	if err != nil {
+		return approval, fmt.Errorf("error al obtener la solicitud de aprobación: %v", err)
+	}
+	if err := doc.DataTo(&approval); err != nil {
+		return approval, fmt.Errorf("error al leer la solicitud de aprobación: %v", err)
+	}
+	return approval, nil
+}
+
+// List devuelve las solicitudes con el estado indicado, de la más antigua a la más nueva
+func (q *Queue) List(ctx context.Context, wanted string) ([]Approval, error) {
+	approvals := []Approval{}
+	it := q.client.Collection("registration_approvals").Where("status", "==", wanted).Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al listar las solicitudes de aprobación: %v", err)
+		}
+		var approval Approval
+		if err := doc.DataTo(&approval); err != nil {
+			continue
+		}
+		approvals = append(approvals, approval)
+	}
+
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].RequestedAt.Before(approvals[j].RequestedAt)
+	})
+	return approvals, nil
+}
+
+// Decide aprueba o rechaza una solicitud pendiente y actualiza el estado de la cuenta. La aprobación
+// quita el estado de users/{uid}; el rechazo lo deja en AccountStatusRejected con el motivo.
+func (q *Queue) Decide(ctx context.Context, uid, actorUID string, approve bool, reason string) (Approval, error) {
+	var approval Approval
+	ref := q.ref(uid)
+	userRef := q.client.Collection("users").Doc(uid)
+
+	err := q.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&approval); err != nil {
+			return err
+		}
+		if approval.Status != StatusPending {
+			return ErrNotPending
+		}
+
+		now := time.Now()
+		approval.DecidedAt = &now
+		approval.DecidedBy = actorUID
+		approval.Reason = reason
+		userUpdates := map[string]interface{}{"status": firestore.Delete}
+		if approve {
+			approval.Status = StatusApproved
+		} else {
+			approval.Status = StatusRejected
+			userUpdates = map[string]interface{}{"status": AccountStatusRejected, "rejectionReason": reason}
+		}
+
+		if err := tx.Set(ref, approval); err != nil {
+			return err
+		}
+		return tx.Set(userRef, userUpdates, firestore.MergeAll)
+	})
+	return approval, err
+}
+
+// Delete elimina la solicitud del usuario, si existe
+func (q *Queue) Delete(ctx context.Context, uid string) error {
+	_, err := q.ref(uid).Delete(ctx)
+	return err
+}
@@ -0,0 +1,215 @@
+// api/audit/audit.go
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/api/authz"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// Resultados de un evento
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Acciones registradas por los controladores
+const (
+	ActionLogin                  = "auth.login"
+	ActionLoginLockout           = "auth.login_lockout"
+	ActionReauthenticate         = "auth.reauthenticate"
+	ActionRegister               = "user.register"
+	ActionVerifyEmail            = "user.verify_email"
+	ActionResendCode             = "user.resend_code"
+	ActionProfileUpdate          = "profile.update"
+	ActionPhotoUpload            = "profile.photo_upload"
+	ActionPhotoDelete            = "profile.photo_delete"
+	ActionPasswordResetRequest   = "password.reset_request"
+	ActionPasswordChange         = "password.change"
+	ActionEmailChangeRequest     = "email.change_request"
+	ActionEmailChange            = "email.change"
+	ActionEmailChangeUndo        = "email.change_undo"
+	ActionIdentityLink           = "identity.link"
+	ActionIdentityUnlink         = "identity.unlink"
+	ActionScopedTokenIssue       = "token.scoped_issue"
+	ActionAPIKeyCreate           = "api_key.create"
+	ActionAPIKeyRevoke           = "api_key.revoke"
+	ActionAccountDeletionRequest = "account.deletion_request"
+	ActionAccountRestore         = "account.restore"
+	ActionAccountDelete          = "account.delete"
+	ActionAccountExport          = "account.export"
+	ActionAccountLock            = "account.lock"
+	ActionNotificationPrefs      = "notifications.preferences_update"
+	ActionAdminUserDisable       = "admin.user_disable"
+	ActionAdminUserEnable        = "admin.user_enable"
+	ActionAdminUserUnlock        = "admin.user_unlock"
+	ActionAdminVerifyEmail       = "admin.verify_email"
+	ActionAdminResendCode        = "admin.resend_code"
+	ActionAdminUserDelete        = "admin.user_delete"
+	ActionRoleAssign             = "role.assign"
+	ActionRoleRevoke             = "role.revoke"
+	ActionImpersonationStart     = "impersonation.start"
+	ActionInvitationCreate       = "invitation.create"
+	ActionInvitationRevoke       = "invitation.revoke"
+	ActionInvitationAccept       = "invitation.accept"
+	ActionOrgCreate              = "org.create"
+	ActionOrgMemberSet           = "org.member_set"
+	ActionOrgMemberRemove        = "org.member_remove"
+	ActionOrgSwitch              = "org.switch"
+	ActionRegistrationRequest    = "registration.approval_request"
+	ActionRegistrationApprove    = "registration.approve"
+	ActionRegistrationReject     = "registration.reject"
+)
+
+// Event representa un evento de seguridad
+type Event struct {
+	ID      string `json:"id" firestore:"-"`
+	Action  string `json:"action" firestore:"action"`
+	Outcome string `json:"outcome" firestore:"outcome"`
+	// ActorUID es quien realizó la acción: el propio usuario, un administrador o quien suplanta al usuario
+	ActorUID string `json:"actorUid,omitempty" firestore:"actorUid,omitempty"`
+	// SubjectUID es el usuario afectado por la acción
+	SubjectUID string `json:"subjectUid,omitempty" firestore:"subjectUid,omitempty"`
+	// Email identifica al usuario cuando no se conoce su UID (por ejemplo, un inicio de sesión fallido)
+	Email           string                 `json:"email,omitempty" firestore:"email,omitempty"`
+	ImpersonationID string                 `json:"impersonationId,omitempty" firestore:"impersonationId,omitempty"`
+	IP              string                 `json:"ip,omitempty" firestore:"ip,omitempty"`
+	UserAgent       string                 `json:"userAgent,omitempty" firestore:"userAgent,omitempty"`
+	Details         map[string]interface{} `json:"details,omitempty" firestore:"details,omitempty"`
+	Timestamp       time.Time              `json:"timestamp" firestore:"timestamp"`
+}
+
+// Sink guarda eventos
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// Logger envía cada evento a todos sus sinks
+type Logger struct {
+	sinks []Sink
+}
+
+// NewLogger crea un Logger con los sinks dados
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// NewLoggerFromEnv crea el Logger configurado en AUDIT_SINKS (lista separada por comas de "firestore"
+// y "file", por defecto "firestore"). El sink de archivo escribe en AUDIT_FILE_PATH (por defecto audit.log).
+func NewLoggerFromEnv(firestoreClient *firestore.Client) (*Logger, error) {
+	config := os.Getenv("AUDIT_SINKS")
+	if strings.TrimSpace(config) == "" {
+		config = "firestore"
+	}
+
+	var sinks []Sink
+	for _, name := range strings.Split(config, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "firestore":
+			sinks = append(sinks, NewFirestoreSink(firestoreClient))
+		case "file":
+			path := os.Getenv("AUDIT_FILE_PATH")
+			if path == "" {
+				path = "audit.log"
+			}
+			sink, err := NewFileSink(path)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		default:
+			return nil, fmt.Errorf("sink de auditoría desconocido: %q", name)
+		}
+	}
+	return NewLogger(sinks...), nil
+}
+
+// Emit envía el evento a los sinks en segundo plano, para no retrasar la respuesta. Los errores se registran en el log.
+func (l *Logger) Emit(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Outcome == "" {
+		event.Outcome = OutcomeSuccess
+	}
+
+	for _, sink := range l.sinks {
+		go func(sink Sink) {
+			if err := sink.Write(context.Background(), event); err != nil {
+				log.Printf("Error al registrar el evento de auditoría %s: %v", event.Action, err)
+			}
+		}(sink)
+	}
+}
+
+// Querier devuelve el primer sink que permite consultar eventos, si existe
+func (l *Logger) Querier() (Querier, bool) {
+	for _, sink := range l.sinks {
+		if querier, ok := sink.(Querier); ok {
+			return querier, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = NewLogger()
+)
+
+// SetDefault establece el Logger que usan Emit y Record. Sin configurar, los eventos se descartan.
+func SetDefault(logger *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = logger
+}
+
+// Default devuelve el Logger configurado con SetDefault
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// Emit registra un evento fuera de una solicitud HTTP (por ejemplo, en los trabajos en segundo plano)
+func Emit(event Event) {
+	Default().Emit(event)
+}
+
+// Record registra un evento de la solicitud. Completa la IP, el user agent y, si hay un usuario
+// autenticado, el actor y el sujeto: el sujeto es el usuario del token salvo que el evento indique
+// otro, y en una suplantación el actor es el administrador.
+func Record(c *gin.Context, event Event) {
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+
+	if user, ok := c.Get("user"); ok {
+		if token, ok := user.(*auth.Token); ok {
+			if event.SubjectUID == "" {
+				event.SubjectUID = token.UID
+			}
+			if event.ActorUID == "" {
+				event.ActorUID = token.UID
+			}
+		}
+	}
+	if actor, ok := c.Get("actor"); ok {
+		if actor, ok := actor.(*authz.Actor); ok {
+			event.ActorUID = actor.UID
+			event.ImpersonationID = actor.ImpersonationID
+		}
+	}
+
+	Default().Emit(event)
+}
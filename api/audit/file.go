@@ -0,0 +1,43 @@
+// api/audit/file.go
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink agrega los eventos a un archivo, un objeto JSON por línea
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink abre (o crea) el archivo en modo de solo agregar
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write agrega el evento como una línea JSON
+func (s *FileSink) Write(_ context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(line)
+	return err
+}
+
+// Close cierra el archivo
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
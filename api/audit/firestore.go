@@ -0,0 +1,85 @@
+// api/audit/firestore.go
+package audit
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Filter representa los filtros de una consulta de eventos. Los campos vacíos no filtran.
+type Filter struct {
+	SubjectUID string
+	ActorUID   string
+	Action     string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// Querier permite consultar los eventos guardados
+type Querier interface {
+	Query(ctx context.Context, filter Filter) ([]Event, error)
+}
+
+// FirestoreSink guarda los eventos en la colección audit_events
+type FirestoreSink struct {
+	client *firestore.Client
+}
+
+// NewFirestoreSink crea un sink de Firestore
+func NewFirestoreSink(client *firestore.Client) *FirestoreSink {
+	return &FirestoreSink{client: client}
+}
+
+// Write guarda el evento
+func (s *FirestoreSink) Write(ctx context.Context, event Event) error {
+	_, _, err := s.client.Collection("audit_events").Add(ctx, event)
+	return err
+}
+
+// Query devuelve los eventos que cumplen el filtro, del más reciente al más antiguo. Combinar filtros
+// de igualdad con el rango de fechas requiere los índices compuestos correspondientes en Firestore.
+func (s *FirestoreSink) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	query := s.client.Collection("audit_events").Query
+	if filter.SubjectUID != "" {
+		query = query.Where("subjectUid", "==", filter.SubjectUID)
+	}
+	if filter.ActorUID != "" {
+		query = query.Where("actorUid", "==", filter.ActorUID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action", "==", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp", ">=", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp", "<=", filter.To)
+	}
+	query = query.OrderBy("timestamp", firestore.Desc)
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	events := []Event{}
+	it := query.Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := doc.DataTo(&event); err != nil {
+			return nil, err
+		}
+		event.ID = doc.Ref.ID
+		events = append(events, event)
+	}
+}
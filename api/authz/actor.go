@@ -0,0 +1,52 @@
+// api/authz/actor.go
+package authz
+
+import "time"
+
+// ActClaim es el claim de los tokens de suplantación que identifica al administrador que actúa en nombre
+// del usuario (como el claim "act" de RFC 8693)
+const ActClaim = "act"
+
+// Actor representa al administrador que suplanta a un usuario
+type Actor struct {
+	UID             string    `json:"uid"`
+	Email           string    `json:"email"`
+	ImpersonationID string    `json:"impersonationId"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
+// Claims devuelve el valor del claim "act" para el actor
+func (a *Actor) Claims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   a.UID,
+		"email": a.Email,
+		"id":    a.ImpersonationID,
+		"exp":   a.ExpiresAt.Unix(),
+	}
+}
+
+// Expired indica si la suplantación ya venció
+func (a *Actor) Expired(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
+
+// ActorFromClaims obtiene el actor del claim "act" de un token, si existe
+func ActorFromClaims(claims map[string]interface{}) (*Actor, bool) {
+	act, ok := claims[ActClaim].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	actor := &Actor{}
+	actor.UID, _ = act["sub"].(string)
+	actor.Email, _ = act["email"].(string)
+	actor.ImpersonationID, _ = act["id"].(string)
+	// Los números de un JWT se decodifican como float64; sin vencimiento el token se considera vencido
+	if exp, ok := act["exp"].(float64); ok {
+		actor.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if actor.UID == "" {
+		return nil, false
+	}
+	return actor, true
+}
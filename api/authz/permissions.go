@@ -0,0 +1,147 @@
+// api/authz/permissions.go
+package authz
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Permisos conocidos por el servicio
+const (
+	PermProfileRead  = "profile:read"
+	PermProfileWrite = "profile:write"
+	PermUsersRead    = "users:read"
+	PermUsersWrite   = "users:write"
+	PermUsersAdmin   = "users:admin"
+	PermOrgsCreate   = "orgs:create"
+	PermAuditRead    = "audit:read"
+)
+
+// defaultRolePermissions es la asignación usada si ROLE_PERMISSIONS no está configurada
+const defaultRolePermissions = "member=profile:read,profile:write;staff=users:read;admin=users:write,users:admin,orgs:create,audit:read"
+
+// ScopeClaim es el claim del token que restringe sus permisos a un subconjunto (separado por espacios,
+// como el parámetro scope de OAuth)
+const ScopeClaim = "scope"
+
+// RolePermissions asigna permisos a los roles. Cada rol hereda los permisos de los roles inferiores
+// de la jerarquía.
+type RolePermissions struct {
+	granted map[string][]string
+}
+
+var (
+	permissionsOnce sync.Once
+	permissions     *RolePermissions
+)
+
+// Permissions devuelve los permisos configurados en ROLE_PERMISSIONS, con el formato
+// "rol=permiso,permiso;rol=permiso". Se carga la primera vez que se usa, después de leer el archivo .env.
+func Permissions() *RolePermissions {
+	permissionsOnce.Do(func() {
+		config := os.Getenv("ROLE_PERMISSIONS")
+		if strings.TrimSpace(config) == "" {
+			config = defaultRolePermissions
+		}
+		permissions = NewRolePermissions(Roles(), ParseRolePermissions(config))
+	})
+	return permissions
+}
+
+// ParseRolePermissions interpreta el formato de ROLE_PERMISSIONS
+func ParseRolePermissions(config string) map[string][]string {
+	assigned := map[string][]string{}
+	for _, entry := range strings.Split(config, ";") {
+		role, perms, found := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !found || role == "" {
+			continue
+		}
+		for _, perm := range strings.Split(perms, ",") {
+			if perm = strings.TrimSpace(perm); perm != "" {
+				assigned[role] = append(assigned[role], perm)
+			}
+		}
+	}
+	return assigned
+}
+
+// NewRolePermissions crea la asignación de permisos, acumulando en cada rol los permisos de los inferiores
+func NewRolePermissions(hierarchy *RoleHierarchy, assigned map[string][]string) *RolePermissions {
+	p := &RolePermissions{granted: map[string][]string{}}
+
+	var inherited []string
+	for _, role := range hierarchy.List() {
+		inherited = mergePermissions(inherited, assigned[role])
+		p.granted[role] = inherited
+	}
+	return p
+}
+
+// For devuelve los permisos efectivos del rol, ordenados. Un rol desconocido no tiene permisos.
+func (p *RolePermissions) For(role string) []string {
+	return append([]string(nil), p.granted[role]...)
+}
+
+// Known indica si algún rol tiene el permiso
+func (p *RolePermissions) Known(perm string) bool {
+	for _, perms := range p.granted {
+		if containsPermission(perms, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Effective devuelve los permisos del rol restringidos por el claim scope del token, si existe
+func (p *RolePermissions) Effective(role string, tokenClaims map[string]interface{}) []string {
+	perms := p.For(role)
+
+	scope, ok := tokenClaims[ScopeClaim].(string)
+	if !ok {
+		return perms
+	}
+
+	scopes := ParseScope(scope)
+	restricted := []string{}
+	for _, perm := range perms {
+		if containsPermission(scopes, perm) {
+			restricted = append(restricted, perm)
+		}
+	}
+	return restricted
+}
+
+// Has indica si el token (con su rol y su scope) concede el permiso
+func (p *RolePermissions) Has(tokenClaims map[string]interface{}, perm string) bool {
+	role, _ := tokenClaims["role"].(string)
+	return containsPermission(p.Effective(role, tokenClaims), perm)
+}
+
+// ParseScope separa un scope de OAuth en sus permisos
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// mergePermissions une dos listas de permisos sin repetidos, ordenadas
+func mergePermissions(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, perm := range b {
+		if !containsPermission(merged, perm) {
+			merged = append(merged, perm)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func containsPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
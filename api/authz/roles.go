@@ -0,0 +1,92 @@
+// api/authz/roles.go
+package authz
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// defaultRoleHierarchy es la jerarquía usada si ROLE_HIERARCHY no está configurada
+const defaultRoleHierarchy = "member,staff,admin"
+
+// RoleHierarchy representa los roles válidos ordenados de menor a mayor privilegio
+type RoleHierarchy struct {
+	roles []string
+	rank  map[string]int
+}
+
+var (
+	rolesOnce sync.Once
+	roles     *RoleHierarchy
+)
+
+// Roles devuelve la jerarquía de roles configurada en ROLE_HIERARCHY (lista separada por comas,
+// de menor a mayor privilegio). Se carga la primera vez que se usa, después de leer el archivo .env.
+func Roles() *RoleHierarchy {
+	rolesOnce.Do(func() {
+		config := os.Getenv("ROLE_HIERARCHY")
+		if strings.TrimSpace(config) == "" {
+			config = defaultRoleHierarchy
+		}
+		roles = NewRoleHierarchy(strings.Split(config, ",")...)
+	})
+	return roles
+}
+
+// NewRoleHierarchy crea una jerarquía con los roles dados, de menor a mayor privilegio
+func NewRoleHierarchy(names ...string) *RoleHierarchy {
+	h := &RoleHierarchy{rank: map[string]int{}}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, exists := h.rank[name]; exists {
+			continue
+		}
+		h.rank[name] = len(h.roles)
+		h.roles = append(h.roles, name)
+	}
+	return h
+}
+
+// List devuelve los roles de menor a mayor privilegio
+func (h *RoleHierarchy) List() []string {
+	return append([]string(nil), h.roles...)
+}
+
+// Valid indica si el rol existe en la jerarquía
+func (h *RoleHierarchy) Valid(role string) bool {
+	_, ok := h.rank[role]
+	return ok
+}
+
+// Default devuelve el rol de menor privilegio, que se asigna a los usuarios verificados
+func (h *RoleHierarchy) Default() string {
+	if len(h.roles) == 0 {
+		return ""
+	}
+	return h.roles[0]
+}
+
+// Highest devuelve el rol de mayor privilegio
+func (h *RoleHierarchy) Highest() string {
+	if len(h.roles) == 0 {
+		return ""
+	}
+	return h.roles[len(h.roles)-1]
+}
+
+// AtLeast indica si role tiene igual o más privilegios que min. Un rol desconocido nunca cumple.
+func (h *RoleHierarchy) AtLeast(role, min string) bool {
+	roleRank, ok := h.rank[role]
+	if !ok {
+		return false
+	}
+	minRank, ok := h.rank[min]
+	if !ok {
+		return false
+	}
+	return roleRank >= minRank
+}
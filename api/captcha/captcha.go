@@ -0,0 +1,89 @@
+// api/captcha/captcha.go
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/api/ratelimit"
+	"backend/api/utils"
+)
+
+var (
+	// ErrMissingToken indica que la solicitud no incluye el token del CAPTCHA
+	ErrMissingToken = errors.New("falta el token del CAPTCHA")
+	// ErrInvalidToken indica que el token no es válido, expiró o ya se usó
+	ErrInvalidToken = errors.New("el token del CAPTCHA no es válido")
+)
+
+// Verifier valida el token de CAPTCHA enviado por el cliente. Devuelve ErrInvalidToken si el token fue
+// rechazado y otro error si no se pudo verificar (por ejemplo, si el proveedor no responde).
+type Verifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+	// Info devuelve lo que el frontend necesita para mostrar el CAPTCHA (proveedor y clave pública)
+	Info() Info
+}
+
+// Challenger es un Verifier que emite sus propios desafíos, como la prueba de trabajo
+type Challenger interface {
+	Verifier
+	Challenge() (Challenge, error)
+}
+
+// Info describe el CAPTCHA configurado
+type Info struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"siteKey,omitempty"`
+}
+
+// NewVerifierFromEnv crea el Verifier configurado en CAPTCHA_PROVIDER:
+//   - "" o "none": sin CAPTCHA (devuelve nil)
+//   - "recaptcha", "hcaptcha", "turnstile" o "siteverify": verificación HTTP con CAPTCHA_SECRET contra
+//     CAPTCHA_VERIFY_URL (obligatoria con "siteverify"); CAPTCHA_SITE_KEY se entrega al frontend y
+//     CAPTCHA_MIN_SCORE fija la puntuación mínima de reCAPTCHA v3
+//   - "pow": prueba de trabajo propia, con CAPTCHA_POW_DIFFICULTY bits en cero (por defecto 20) y
+//     desafíos válidos durante CAPTCHA_POW_TTL (por defecto 5m); los desafíos usados se guardan en store
+func NewVerifierFromEnv(store ratelimit.Store) (Verifier, error) {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("CAPTCHA_PROVIDER")))
+	switch provider {
+	case "", "none":
+		return nil, nil
+	case "pow":
+		difficulty := defaultDifficulty
+		if value := strings.TrimSpace(os.Getenv("CAPTCHA_POW_DIFFICULTY")); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxDifficulty {
+				return nil, fmt.Errorf("CAPTCHA_POW_DIFFICULTY inválido: %q", value)
+			}
+			difficulty = n
+		}
+		ttl := defaultChallengeTTL
+		if value := strings.TrimSpace(os.Getenv("CAPTCHA_POW_TTL")); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("CAPTCHA_POW_TTL inválido: %q", value)
+			}
+			ttl = d
+		}
+		return NewProofOfWork(utils.SecretKey, difficulty, ttl, store), nil
+	}
+
+	verifier, err := NewSiteVerify(provider, os.Getenv("CAPTCHA_SECRET"), os.Getenv("CAPTCHA_VERIFY_URL"))
+	if err != nil {
+		return nil, err
+	}
+	verifier.SiteKey = os.Getenv("CAPTCHA_SITE_KEY")
+	if value := strings.TrimSpace(os.Getenv("CAPTCHA_MIN_SCORE")); value != "" {
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil || score < 0 || score > 1 {
+			return nil, fmt.Errorf("CAPTCHA_MIN_SCORE inválido: %q", value)
+		}
+		verifier.MinScore = score
+	}
+	return verifier, nil
+}
@@ -0,0 +1,140 @@
+// api/captcha/pow.go
+package captcha
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/api/ratelimit"
+)
+
+const (
+	defaultDifficulty   = 20
+	maxDifficulty       = 32
+	defaultChallengeTTL = 5 * time.Minute
+)
+
+// Challenge es un desafío de prueba de trabajo. El cliente debe encontrar un texto solution tal que
+// SHA-256(challenge + ":" + solution) empiece con Difficulty bits en cero, y enviar como token
+// challenge + ":" + solution.
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// ProofOfWork es un CAPTCHA propio que no depende de terceros: encarece el envío automatizado de
+// formularios exigiendo trabajo de CPU en el cliente. Los desafíos van firmados con HMAC, por lo que no
+// se guardan al emitirlos; solo se recuerdan los ya usados, en el Store del rate limit para que un
+// desafío no se pueda repetir en otra réplica.
+type ProofOfWork struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	spent      ratelimit.Store
+}
+
+// NewProofOfWork crea un ProofOfWork que firma los desafíos con secret y recuerda los usados en spent
+func NewProofOfWork(secret []byte, difficulty int, ttl time.Duration, spent ratelimit.Store) *ProofOfWork {
+	return &ProofOfWork{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		spent:      spent,
+	}
+}
+
+// sign calcula la firma de los campos del desafío
+func (p *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte("captcha_pow:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Challenge implementa Challenger
+func (p *ProofOfWork) Challenge() (Challenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, fmt.Errorf("error al generar el desafío: %v", err)
+	}
+	expiresAt := time.Now().Add(p.ttl).Truncate(time.Second)
+	payload := fmt.Sprintf("%s.%d.%d", base64.RawURLEncoding.EncodeToString(nonce), expiresAt.Unix(), p.difficulty)
+	return Challenge{
+		Challenge:  payload + "." + p.sign(payload),
+		Difficulty: p.difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify implementa Verifier. Cada desafío resuelto se acepta una sola vez.
+func (p *ProofOfWork) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrMissingToken
+	}
+	challenge, solution, ok := strings.Cut(token, ":")
+	if !ok || solution == "" {
+		return ErrInvalidToken
+	}
+
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return ErrInvalidToken
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(p.sign(payload))) {
+		return ErrInvalidToken
+	}
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+	if !time.Now().Before(expiresAt) {
+		return ErrInvalidToken
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil || difficulty < p.difficulty {
+		return ErrInvalidToken
+	}
+
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrInvalidToken
+	}
+
+	// Un desafío se acepta una sola vez mientras está vigente, y nunca está vigente más de ttl
+	result, err := p.spent.Allow(ctx, "captcha_pow:"+parts[0], ratelimit.Limit{Algorithm: ratelimit.SlidingWindow, Rate: 1, Period: p.ttl})
+	if err != nil {
+		return fmt.Errorf("error al registrar el desafío usado: %v", err)
+	}
+	if !result.Allowed {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// Info implementa Verifier
+func (p *ProofOfWork) Info() Info {
+	return Info{Provider: "pow"}
+}
+
+// leadingZeroBits cuenta los bits en cero al comienzo del hash
+func leadingZeroBits(sum []byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
@@ -0,0 +1,132 @@
+package captcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"backend/api/ratelimit"
+)
+
+const testDifficulty = 8
+
+// signedChallenge arma un desafío firmado por p con la expiración y la dificultad indicadas
+func signedChallenge(p *ProofOfWork, nonce string, expiresAt time.Time, difficulty int) string {
+	payload := fmt.Sprintf("%s.%d.%d", nonce, expiresAt.Unix(), difficulty)
+	return payload + "." + p.sign(payload)
+}
+
+// solve busca una solución del desafío con la dificultad indicada; con valid en false busca una que no la cumpla
+func solve(t *testing.T, challenge string, difficulty int, valid bool) string {
+	t.Helper()
+	for i := 0; i < 1<<24; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if (leadingZeroBits(sum[:]) >= difficulty) == valid {
+			return solution
+		}
+	}
+	t.Fatalf("no se encontró una solución para %q", challenge)
+	return ""
+}
+
+func TestProofOfWorkVerify(t *testing.T) {
+	p := NewProofOfWork([]byte("secret"), testDifficulty, time.Minute, ratelimit.NewMemoryStore())
+	other := NewProofOfWork([]byte("other-secret"), testDifficulty, time.Minute, ratelimit.NewMemoryStore())
+	future := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name  string
+		token func() string
+		want  error
+	}{
+		{
+			name: "válido",
+			token: func() string {
+				challenge, err := p.Challenge()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return challenge.Challenge + ":" + solve(t, challenge.Challenge, challenge.Difficulty, true)
+			},
+		},
+		{
+			name:  "sin token",
+			token: func() string { return "" },
+			want:  ErrMissingToken,
+		},
+		{
+			name:  "sin solución",
+			token: func() string { return signedChallenge(p, "sin-solucion", future, testDifficulty) },
+			want:  ErrInvalidToken,
+		},
+		{
+			name: "firma de otro secreto",
+			token: func() string {
+				challenge := signedChallenge(other, "otro-secreto", future, testDifficulty)
+				return challenge + ":" + solve(t, challenge, testDifficulty, true)
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "expirado",
+			token: func() string {
+				challenge := signedChallenge(p, "expirado", time.Now().Add(-time.Second), testDifficulty)
+				return challenge + ":" + solve(t, challenge, testDifficulty, true)
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "dificultad rebajada",
+			token: func() string {
+				challenge := signedChallenge(p, "rebajado", future, testDifficulty-4)
+				return challenge + ":" + solve(t, challenge, testDifficulty-4, true)
+			},
+			want: ErrInvalidToken,
+		},
+		{
+			name: "trabajo insuficiente",
+			token: func() string {
+				challenge := signedChallenge(p, "insuficiente", future, testDifficulty)
+				return challenge + ":" + solve(t, challenge, testDifficulty, false)
+			},
+			want: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Verify(context.Background(), tt.token(), "")
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, se esperaba %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProofOfWorkReplay(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	// Dos réplicas que comparten el Store
+	first := NewProofOfWork([]byte("secret"), testDifficulty, time.Minute, store)
+	second := NewProofOfWork([]byte("secret"), testDifficulty, time.Minute, store)
+
+	challenge, err := first.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := challenge.Challenge + ":" + solve(t, challenge.Challenge, challenge.Difficulty, true)
+
+	if err := first.Verify(context.Background(), token, ""); err != nil {
+		t.Fatalf("primer uso: Verify() = %v", err)
+	}
+	if err := first.Verify(context.Background(), token, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("repetido en la misma réplica: Verify() = %v, se esperaba %v", err, ErrInvalidToken)
+	}
+	if err := second.Verify(context.Background(), token, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("repetido en otra réplica: Verify() = %v, se esperaba %v", err, ErrInvalidToken)
+	}
+}
@@ -0,0 +1,104 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSiteVerifyVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		status   int
+		body     string
+		minScore float64
+		want     error
+		// wantErr indica un error de verificación que no es ErrMissingToken ni ErrInvalidToken
+		wantErr bool
+	}{
+		{name: "aceptado", token: "ok", status: http.StatusOK, body: `{"success": true}`},
+		{name: "sin token", token: "", want: ErrMissingToken},
+		{name: "rechazado", token: "bad", status: http.StatusOK, body: `{"success": false, "error-codes": ["invalid-input-response"]}`, want: ErrInvalidToken},
+		{name: "puntuación suficiente", token: "ok", status: http.StatusOK, body: `{"success": true, "score": 0.9}`, minScore: 0.5},
+		{name: "puntuación baja", token: "ok", status: http.StatusOK, body: `{"success": true, "score": 0.1}`, minScore: 0.5, want: ErrInvalidToken},
+		{name: "sin puntuación", token: "ok", status: http.StatusOK, body: `{"success": true}`, minScore: 0.5},
+		{name: "error del proveedor", token: "ok", status: http.StatusInternalServerError, body: `{}`, wantErr: true},
+		{name: "respuesta inválida", token: "ok", status: http.StatusOK, body: `no es json`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Errorf("formulario inválido: %v", err)
+				}
+				if got := r.PostForm.Get("secret"); got != "secret" {
+					t.Errorf("secret = %q, se esperaba %q", got, "secret")
+				}
+				if got := r.PostForm.Get("response"); got != tt.token {
+					t.Errorf("response = %q, se esperaba %q", got, tt.token)
+				}
+				if got := r.PostForm.Get("remoteip"); got != "203.0.113.7" {
+					t.Errorf("remoteip = %q, se esperaba %q", got, "203.0.113.7")
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			verifier, err := NewSiteVerify("siteverify", "secret", server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier.MinScore = tt.minScore
+
+			err = verifier.Verify(context.Background(), tt.token, "203.0.113.7")
+			switch {
+			case tt.wantErr:
+				if err == nil || errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrMissingToken) {
+					t.Errorf("Verify() = %v, se esperaba un error del proveedor", err)
+				}
+			case !errors.Is(err, tt.want):
+				t.Errorf("Verify() = %v, se esperaba %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSiteVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		secret    string
+		verifyURL string
+		wantURL   string
+		wantErr   bool
+	}{
+		{name: "proveedor conocido", provider: "turnstile", secret: "s", wantURL: siteVerifyURLs["turnstile"]},
+		{name: "URL configurada", provider: "recaptcha", secret: "s", verifyURL: "http://localhost:9999/verify", wantURL: "http://localhost:9999/verify"},
+		{name: "genérico sin URL", provider: "siteverify", secret: "s", wantErr: true},
+		{name: "sin secreto", provider: "hcaptcha", wantErr: true},
+		{name: "proveedor desconocido", provider: "otro", secret: "s", verifyURL: "http://localhost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewSiteVerify(tt.provider, tt.secret, tt.verifyURL)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NewSiteVerify() no devolvió error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewSiteVerify() = %v", err)
+			}
+			if verifier.URL != tt.wantURL {
+				t.Errorf("URL = %q, se esperaba %q", verifier.URL, tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// api/claims/claims.go
+package claims
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"firebase.google.com/go/auth"
+)
+
+// MaxSize es el tamaño máximo en bytes que Firebase permite para los custom claims serializados en JSON
+const MaxSize = 1000
+
+// Claves de custom claims que usa el servicio
+const (
+	KeyRole    = "role"
+	KeyName    = "name"
+	KeyPicture = "picture"
+	// KeyOrg y KeyOrgRole identifican la organización actual del usuario y su rol en ella
+	KeyOrg     = "org"
+	KeyOrgRole = "orgRole"
+)
+
+// lockStripes es la cantidad de mutex entre los que se reparten los usuarios
+const lockStripes = 64
+
+// DefaultKeys son las claves permitidas desde el inicio
+var DefaultKeys = []string{KeyRole, KeyName, KeyPicture, KeyOrg, KeyOrgRole}
+
+// reservedKeys son claims de OIDC/Firebase que no se pueden usar como custom claims
+var reservedKeys = map[string]bool{
+	"acr": true, "amr": true, "at_hash": true, "aud": true, "auth_time": true, "azp": true, "cnf": true,
+	"c_hash": true, "exp": true, "firebase": true, "iat": true, "iss": true, "jti": true, "nbf": true,
+	"nonce": true, "sub": true,
+}
+
+var (
+	// ErrUnknownKey indica que se intentó escribir una clave que no está en el registro
+	ErrUnknownKey = errors.New("clave de custom claim no permitida")
+	// ErrTooLarge indica que los custom claims resultantes superan el límite de Firebase
+	ErrTooLarge = errors.New("los custom claims superan el límite de 1000 bytes")
+)
+
+// Manager actualiza los custom claims de los usuarios mezclando los cambios con los claims existentes,
+// en lugar de reemplazarlos como hace SetCustomUserClaims.
+type Manager struct {
+	authClient *auth.Client
+
+	mu      sync.RWMutex
+	allowed map[string]bool
+
+	// locks serializa las actualizaciones de un mismo usuario dentro de esta instancia. Es un arreglo fijo
+	// indexado por el hash del UID, de modo que no crece con cada usuario; dos usuarios pueden compartir un
+	// mutex, lo que solo serializa de más.
+	locks [lockStripes]sync.Mutex
+}
+
+// NewManager crea un Manager que permite las claves dadas
+func NewManager(authClient *auth.Client, keys ...string) *Manager {
+	m := &Manager{authClient: authClient, allowed: map[string]bool{}}
+	m.Register(keys...)
+	return m
+}
+
+// Register agrega claves al registro de custom claims permitidos
+func (m *Manager) Register(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if reservedKeys[key] {
+			panic(fmt.Sprintf("claims: %q es un claim reservado", key))
+		}
+		m.allowed[key] = true
+	}
+}
+
+// Allowed indica si la clave está en el registro
+func (m *Manager) Allowed(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.allowed[key]
+}
+
+// Get devuelve los custom claims actuales del usuario
+func (m *Manager) Get(ctx context.Context, uid string) (map[string]interface{}, error) {
+	user, err := m.authClient.GetUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]interface{}{}
+	for key, value := range user.CustomClaims {
+		current[key] = value
+	}
+	return current, nil
+}
+
+// Merge lee los custom claims del usuario, aplica los cambios y los guarda. Una clave con valor nil
+// se elimina. Las claves existentes que no se modifican se conservan. Devuelve los claims resultantes.
+func (m *Manager) Merge(ctx context.Context, uid string, updates map[string]interface{}) (map[string]interface{}, error) {
+	for key := range updates {
+		if !m.Allowed(key) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, key)
+		}
+	}
+
+	lock := m.lockFor(uid)
+	lock.Lock()
+	defer lock.Unlock()
+
+	merged, err := m.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for key, value := range updates {
+		current, exists := merged[key]
+		if value == nil {
+			if exists {
+				delete(merged, key)
+				changed = true
+			}
+			continue
+		}
+		if !exists || !sameValue(current, value) {
+			merged[key] = value
+			changed = true
+		}
+	}
+	if !changed {
+		return merged, nil
+	}
+
+	if err := checkSize(merged); err != nil {
+		return nil, err
+	}
+
+	if err := m.authClient.SetCustomUserClaims(ctx, uid, merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// lockFor devuelve el mutex que serializa las actualizaciones de uid
+func (m *Manager) lockFor(uid string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(uid))
+	return &m.locks[h.Sum32()%lockStripes]
+}
+
+// Set asigna un único custom claim conservando los demás
+func (m *Manager) Set(ctx context.Context, uid, key string, value interface{}) (map[string]interface{}, error) {
+	return m.Merge(ctx, uid, map[string]interface{}{key: value})
+}
+
+// Remove elimina custom claims conservando los demás
+func (m *Manager) Remove(ctx context.Context, uid string, keys ...string) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	for _, key := range keys {
+		updates[key] = nil
+	}
+	return m.Merge(ctx, uid, updates)
+}
+
+// checkSize verifica que los claims serializados no superen el límite de Firebase
+func checkSize(claims map[string]interface{}) error {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return fmt.Errorf("error al serializar los custom claims: %v", err)
+	}
+	if len(encoded) > MaxSize {
+		return fmt.Errorf("%w (%d bytes)", ErrTooLarge, len(encoded))
+	}
+	return nil
+}
+
+// sameValue compara dos valores por su representación JSON, que es como Firebase los almacena
+func sameValue(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
@@ -0,0 +1,98 @@
+// backend/api/controllers/admin_audit.go
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/httputil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Límites de la consulta del registro de auditoría
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// AdminListAuditEvents consulta el registro de auditoría.
+//
+// Requiere el sink de Firestore (AUDIT_SINKS). Los eventos se devuelven del más reciente al más antiguo.
+//
+// @Summary Consultar auditoría
+// @Description Lista los eventos de auditoría filtrados por usuario afectado, actor, acción y rango de fechas.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid query string false "UID del usuario afectado"
+// @Param actor query string false "UID de quien realizó la acción"
+// @Param action query string false "Acción (por ejemplo auth.login)"
+// @Param from query string false "Desde (RFC3339)"
+// @Param to query string false "Hasta (RFC3339)"
+// @Param limit query int false "Cantidad máxima de eventos (100 por defecto, máximo 1000)"
+// @Success 200 {object} httputil.StandardResponse "Eventos de auditoría"
+// @Failure 400 {object} httputil.ErrorResponse "Filtros inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Failure 501 {object} httputil.ErrorResponse "El registro de auditoría no se puede consultar"
+// @Router /admin/audit [get]
+func AdminListAuditEvents(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: err.Error()})
+		return
+	}
+
+	querier, ok := audit.Default().Querier()
+	if !ok {
+		c.JSON(http.StatusNotImplemented, httputil.ErrorResponse{Message: "El registro de auditoría no se puede consultar; configura el sink de Firestore"})
+		return
+	}
+
+	events, err := querier.Query(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error al consultar el registro de auditoría: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Eventos obtenidos correctamente", Data: events})
+}
+
+// parseAuditFilter lee los filtros de la consulta de auditoría desde la query.
+func parseAuditFilter(c *gin.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		SubjectUID: c.Query("uid"),
+		ActorUID:   c.Query("actor"),
+		Action:     c.Query("action"),
+		Limit:      auditDefaultLimit,
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("El parámetro %s debe tener formato RFC3339", name)
+			}
+			*target = parsed
+		}
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > auditMaxLimit {
+			return filter, fmt.Errorf("El parámetro limit debe estar entre 1 y %d", auditMaxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,151 @@
+// backend/api/controllers/admin_impersonation.go
+
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// impersonationTTL es la vigencia de una suplantación
+const impersonationTTL = 15 * time.Minute
+
+// ImpersonateRequest representa la solicitud para suplantar a un usuario
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// Impersonation representa el registro de una suplantación en impersonations/{id}
+type Impersonation struct {
+	ActorUID   string    `json:"actorUid" firestore:"actorUid"`
+	ActorEmail string    `json:"actorEmail" firestore:"actorEmail"`
+	SubjectUID string    `json:"subjectUid" firestore:"subjectUid"`
+	Reason     string    `json:"reason" firestore:"reason"`
+	IP         string    `json:"ip" firestore:"ip"`
+	UserAgent  string    `json:"userAgent" firestore:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt" firestore:"expiresAt"`
+}
+
+// AdminImpersonateUser emite un token de corta duración para actuar como el usuario indicado.
+//
+// El token incluye el claim "act" con el administrador, que AuthMiddleware expone como "actor" y usa
+// para rechazarlo pasados 15 minutos. No se entrega refresh token. Durante la suplantación no se pueden
+// cambiar la contraseña, el correo ni las credenciales, ni eliminar la cuenta. Cada suplantación queda
+// registrada en impersonations/{id}. No se puede suplantar a un usuario con un rol igual o superior.
+//
+// @Summary Suplantar usuario
+// @Description Emite un ID token de 15 minutos para el usuario con el claim "act" del administrador.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Param body body ImpersonateRequest true "Motivo de la suplantación"
+// @Success 200 {object} httputil.StandardResponse "Token de suplantación"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos o usuario desactivado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/impersonate [post]
+func AdminImpersonateUser(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Debes indicar el motivo de la suplantación"})
+		return
+	}
+
+	ctx := context.Background()
+	uid := c.Param("uid")
+	adminTok := c.MustGet("user").(*auth.Token)
+
+	// No se encadenan suplantaciones ni se suplanta a uno mismo
+	if _, impersonating := c.Get("actor"); impersonating || adminTok.UID == uid {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "No puedes suplantar a este usuario"})
+		return
+	}
+
+	user, err := authClient.GetUser(ctx, uid)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+	if user.Disabled {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "El usuario está desactivado"})
+		return
+	}
+
+	adminRole, _ := adminTok.Claims["role"].(string)
+	if userRole, _ := user.CustomClaims["role"].(string); userRole != "" && authz.Roles().AtLeast(userRole, adminRole) {
+		c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No puedes suplantar a un usuario con un rol igual o superior al tuyo"})
+		return
+	}
+
+	now := time.Now()
+	adminEmail, _ := adminTok.Claims["email"].(string)
+	docRef := firestoreClient.Collection("impersonations").NewDoc()
+	record := Impersonation{
+		ActorUID:   adminTok.UID,
+		ActorEmail: adminEmail,
+		SubjectUID: uid,
+		Reason:     strings.TrimSpace(req.Reason),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(impersonationTTL),
+	}
+
+	// El registro se guarda antes de emitir el token para que no exista una suplantación sin rastro
+	if _, err := docRef.Create(ctx, record); err != nil {
+		log.Printf("Error al registrar la suplantación de %s por %s: %v", uid, adminTok.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	actor := &authz.Actor{UID: adminTok.UID, Email: adminEmail, ImpersonationID: docRef.ID, ExpiresAt: record.ExpiresAt}
+	customToken, err := authClient.CustomTokenWithClaims(ctx, uid, map[string]interface{}{
+		authz.ActClaim: actor.Claims(),
+	})
+	if err != nil {
+		log.Printf("Error al crear el token de suplantación de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al emitir el token"})
+		return
+	}
+
+	result, err := identityToolkitPost("signInWithCustomToken", map[string]interface{}{
+		"token":             customToken,
+		"returnSecureToken": true,
+	})
+	if err != nil {
+		log.Printf("Error al canjear el token de suplantación de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al comunicarse con Firebase"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:          audit.ActionImpersonationStart,
+		SubjectUID:      uid,
+		ImpersonationID: docRef.ID,
+		Details:         map[string]interface{}{"reason": record.Reason, "expiresAt": record.ExpiresAt},
+	})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Suplantación iniciada",
+		Data: map[string]interface{}{
+			"token":           result["idToken"],
+			"impersonationId": docRef.ID,
+			"expiresAt":       record.ExpiresAt,
+		},
+	})
+}
@@ -0,0 +1,173 @@
+// backend/api/controllers/admin_roles.go
+
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/claims"
+	"backend/api/httputil"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// AssignRoleRequest representa la solicitud para asignar un rol a un usuario
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// AdminListRoles lista los roles configurados, de menor a mayor privilegio.
+//
+// @Summary Listar roles
+// @Description Lista los roles configurados en ROLE_HIERARCHY, de menor a mayor privilegio.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Roles"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Router /admin/roles [get]
+func AdminListRoles(c *gin.Context) {
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Roles obtenidos correctamente",
+		Data:    authz.Roles().List(),
+	})
+}
+
+// AdminAssignRole asigna un rol a un usuario.
+//
+// El cambio se aplica revocando las sesiones del usuario, de modo que debe volver a iniciar sesión
+// para obtener un token con el nuevo rol.
+//
+// @Summary Asignar rol
+// @Description Asigna un rol de la jerarquía configurada al usuario y revoca sus sesiones.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Param body body AssignRoleRequest true "Rol a asignar"
+// @Success 200 {object} httputil.StandardResponse "Rol asignado"
+// @Failure 400 {object} httputil.ErrorResponse "Rol inválido"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/role [put]
+func AdminAssignRole(c *gin.Context, authClient *auth.Client, claimsManager *claims.Manager) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	if !authz.Roles().Valid(req.Role) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Rol inválido"})
+		return
+	}
+
+	changeUserRole(c, authClient, claimsManager, req.Role)
+}
+
+// AdminRevokeRole quita el rol de un usuario.
+//
+// @Summary Revocar rol
+// @Description Quita el rol del usuario y revoca sus sesiones.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Rol revocado"
+// @Failure 400 {object} httputil.ErrorResponse "No se puede cambiar el rol propio"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/role [delete]
+func AdminRevokeRole(c *gin.Context, authClient *auth.Client, claimsManager *claims.Manager) {
+	changeUserRole(c, authClient, claimsManager, "")
+}
+
+// AdminGetUserPermissions devuelve el rol y los permisos efectivos de un usuario.
+//
+// @Summary Permisos de un usuario
+// @Description Devuelve el rol del usuario y los permisos que concede según ROLE_PERMISSIONS.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Permisos del usuario"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/permissions [get]
+func AdminGetUserPermissions(c *gin.Context, authClient *auth.Client) {
+	uid := c.Param("uid")
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	role, _ := user.CustomClaims["role"].(string)
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Permisos obtenidos correctamente",
+		Data: map[string]interface{}{
+			"uid":         uid,
+			"role":        role,
+			"permissions": authz.Permissions().For(role),
+		},
+	})
+}
+
+// changeUserRole asigna (o quita, si role está vacío) el rol del usuario de la ruta y revoca sus sesiones.
+func changeUserRole(c *gin.Context, authClient *auth.Client, claimsManager *claims.Manager, role string) {
+	uid := c.Param("uid")
+
+	// Evitar que un administrador se quite a sí mismo el acceso a la administración
+	if token, ok := c.Get("user"); ok && token.(*auth.Token).UID == uid {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "No puedes cambiar tu propio rol"})
+		return
+	}
+
+	// Un rol vacío elimina el claim; los demás custom claims del usuario se conservan
+	var value interface{}
+	if role != "" {
+		value = role
+	}
+	userClaims, err := claimsManager.Set(context.Background(), uid, claims.KeyRole, value)
+	if err != nil {
+		if auth.IsUserNotFound(err) {
+			respondAdminUserError(c, uid, err)
+			return
+		}
+		log.Printf("Error al cambiar el rol del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al cambiar el rol"})
+		return
+	}
+
+	// Revocar las sesiones para que el cambio de rol tenga efecto de inmediato
+	if err := authClient.RevokeRefreshTokens(context.Background(), uid); err != nil {
+		log.Printf("Error al revocar las sesiones del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al revocar las sesiones del usuario"})
+		return
+	}
+
+	message, action := "Rol asignado correctamente", audit.ActionRoleAssign
+	if role == "" {
+		message, action = "Rol revocado correctamente", audit.ActionRoleRevoke
+	}
+	audit.Record(c, audit.Event{Action: action, SubjectUID: uid, Details: map[string]interface{}{"role": role}})
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: message,
+		Data:    map[string]interface{}{"uid": uid, "role": userClaims[claims.KeyRole]},
+	})
+}
@@ -0,0 +1,523 @@
+// backend/api/controllers/admin_users.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/api/approvals"
+	"backend/api/audit"
+	"backend/api/claims"
+	"backend/api/domainpolicy"
+	"backend/api/httputil"
+	"backend/api/lockout"
+	"backend/api/passwordhistory"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Límites de la paginación del listado de usuarios
+const (
+	adminDefaultPageSize = 50
+	adminMaxPageSize     = 500
+	// adminMaxScannedPages limita cuántas páginas de Firebase Auth se recorren por solicitud al filtrar
+	adminMaxScannedPages = 20
+)
+
+// profileSecretFields son campos de users/{uid} que no se muestran en la API de administración
+var profileSecretFields = []string{
+	"verificationCode", "verificationCodeHash", "pendingEmailCode", "pendingEmailCodeHash", "emailUndoID",
+	passwordhistory.FieldHistory,
+}
+
+// AdminUserSummary representa un usuario en el listado de la API de administración
+type AdminUserSummary struct {
+	UID           string      `json:"uid"`
+	Email         string      `json:"email"`
+	DisplayName   string      `json:"displayName"`
+	EmailVerified bool        `json:"emailVerified"`
+	Disabled      bool        `json:"disabled"`
+	Role          interface{} `json:"role"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	LastLoginAt   *time.Time  `json:"lastLoginAt,omitempty"`
+}
+
+// AdminUserListResponse representa una página del listado de usuarios
+type AdminUserListResponse struct {
+	Users      []AdminUserSummary `json:"users"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+// adminUserFilter representa los filtros del listado de usuarios
+type adminUserFilter struct {
+	verified    *bool
+	role        string
+	createdFrom time.Time
+	createdTo   time.Time
+}
+
+// AdminListUsers lista los usuarios de Firebase Auth con paginación por cursor y filtros.
+//
+// @Summary Listar usuarios
+// @Description Lista los usuarios con paginación por cursor, filtrando por verificación, rol y fecha de creación.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param limit query int false "Cantidad máxima de usuarios (por defecto 50, máximo 500)"
+// @Param cursor query string false "Cursor devuelto por la página anterior"
+// @Param verified query bool false "Filtrar por correo verificado"
+// @Param role query string false "Filtrar por rol"
+// @Param createdFrom query string false "Creados desde (RFC3339)"
+// @Param createdTo query string false "Creados hasta (RFC3339)"
+// @Success 200 {object} httputil.StandardResponse{data=AdminUserListResponse} "Página de usuarios"
+// @Failure 400 {object} httputil.ErrorResponse "Parámetros inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users [get]
+func AdminListUsers(c *gin.Context, authClient *auth.Client) {
+	limit := adminDefaultPageSize
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > adminMaxPageSize {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Parámetro limit inválido"})
+			return
+		}
+		limit = parsed
+	}
+
+	filter, err := parseAdminUserFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: err.Error()})
+		return
+	}
+
+	// Se pide a Firebase solo lo que falta para completar la página, así los filtros nunca
+	// devuelven más de limit usuarios ni se salta ninguno entre una página y la siguiente
+	users := []AdminUserSummary{}
+	cursor := c.Query("cursor")
+	for scanned := 0; len(users) < limit && scanned < adminMaxScannedPages; scanned++ {
+		var page []*auth.ExportedUserRecord
+		pager := iterator.NewPager(authClient.Users(context.Background(), cursor), limit-len(users), cursor)
+		nextCursor, err := pager.NextPage(&page)
+		if err != nil {
+			log.Printf("Error al listar usuarios de Firebase Auth: %v", err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al listar usuarios"})
+			return
+		}
+
+		for _, record := range page {
+			if filter.matches(record.UserRecord) {
+				users = append(users, adminUserSummary(record.UserRecord))
+			}
+		}
+
+		cursor = nextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Usuarios obtenidos correctamente",
+		Data:    AdminUserListResponse{Users: users, NextCursor: cursor},
+	})
+}
+
+// AdminGetUser obtiene un usuario combinando su registro de Firebase Auth con su documento users/{uid}.
+//
+// @Summary Obtener usuario
+// @Description Obtiene un usuario combinando Firebase Auth y Firestore.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Usuario"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid} [get]
+func AdminGetUser(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	uid := c.Param("uid")
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	profile := map[string]interface{}{}
+	doc, err := firestoreClient.Collection("users").Doc(uid).Get(context.Background())
+	if err == nil {
+		profile = doc.Data()
+		for _, field := range profileSecretFields {
+			delete(profile, field)
+		}
+	} else if status.Code(err) != codes.NotFound {
+		log.Printf("Error al obtener el perfil del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener el perfil del usuario"})
+		return
+	}
+
+	providers := []string{}
+	for _, info := range user.ProviderUserInfo {
+		providers = append(providers, info.ProviderID)
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Usuario obtenido correctamente",
+		Data: map[string]interface{}{
+			"auth": map[string]interface{}{
+				"summary":      adminUserSummary(user),
+				"customClaims": user.CustomClaims,
+				"providers":    providers,
+			},
+			"profile": profile,
+		},
+	})
+}
+
+// AdminSetUserDisabled desactiva o reactiva un usuario en Firebase Auth.
+//
+// Al desactivar, también se revocan las sesiones activas del usuario.
+//
+// @Summary Desactivar o reactivar usuario
+// @Description Desactiva (POST /disable) o reactiva (POST /enable) un usuario. Reactivar una cuenta programada para eliminación cancela la eliminación.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Usuario actualizado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 409 {object} httputil.ErrorResponse "La cuenta se está eliminando"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/disable [post]
+// @Router /admin/users/{uid}/enable [post]
+func AdminSetUserDisabled(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, disabled bool) {
+	uid := c.Param("uid")
+
+	// Reactivar una cuenta programada para eliminación cancela la eliminación, para que el purgador no
+	// elimine una cuenta que el administrador reactivó
+	if !disabled {
+		_, err := cancelAccountDeletion(context.Background(), firestoreClient, uid, "")
+		switch {
+		case err == nil, status.Code(err) == codes.NotFound:
+		case errors.Is(err, errAccountNotRestorable):
+			c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La cuenta se está eliminando y ya no se puede reactivar"})
+			return
+		default:
+			respondAdminUserError(c, uid, err)
+			return
+		}
+	}
+
+	if _, err := authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Disabled(disabled)); err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	// Una cuenta desactivada por el administrador durante el plazo de gracia no se reactiva al restaurarla
+	if disabled {
+		if err := markDeletionDisabledByAdmin(context.Background(), firestoreClient, uid); err != nil {
+			log.Printf("Advertencia: no se pudo registrar la desactivación en la eliminación programada de %s: %v", uid, err)
+		}
+	}
+
+	// La decisión del administrador reemplaza un bloqueo desde una notificación: así el restablecimiento
+	// de contraseña posterior no reactiva una cuenta que el administrador desactivó
+	if err := clearAccountLock(context.Background(), firestoreClient, uid); err != nil {
+		log.Printf("Advertencia: no se pudo quitar el bloqueo del perfil del usuario %s: %v", uid, err)
+	}
+
+	if disabled {
+		if err := authClient.RevokeRefreshTokens(context.Background(), uid); err != nil {
+			log.Printf("Advertencia: no se pudieron revocar las sesiones del usuario %s: %v", uid, err)
+		}
+	}
+
+	action := audit.ActionAdminUserEnable
+	if disabled {
+		action = audit.ActionAdminUserDisable
+	}
+	audit.Record(c, audit.Event{Action: action, SubjectUID: uid})
+	message := "Usuario reactivado correctamente"
+	if disabled {
+		message = "Usuario desactivado correctamente"
+	}
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: message})
+}
+
+// AdminUnlockUser quita el bloqueo temporal por intentos fallidos de inicio de sesión de un usuario.
+//
+// @Summary Desbloquear inicio de sesión
+// @Description Reinicia los intentos fallidos de inicio de sesión del usuario y quita su bloqueo temporal.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Usuario desbloqueado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/unlock [post]
+func AdminUnlockUser(c *gin.Context, authClient *auth.Client, loginGuard *lockout.Guard) {
+	uid := c.Param("uid")
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	attempts, err := loginGuard.Status(context.Background(), user.Email)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+	if err := loginGuard.Unlock(context.Background(), user.Email); err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAdminUserUnlock, SubjectUID: uid, Email: user.Email})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Usuario desbloqueado correctamente",
+		Data:    map[string]interface{}{"previousAttempts": attempts},
+	})
+}
+
+// AdminForceVerifyEmail marca como verificado el correo de un usuario sin pasar por el código.
+//
+// @Summary Forzar verificación de correo
+// @Description Marca el correo del usuario como verificado en Firebase Auth y Firestore. Con la aprobación de registros activa, el usuario queda pendiente de aprobación en lugar de recibir su rol.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Usuario verificado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/verify-email [post]
+func AdminForceVerifyEmail(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, claimsManager *claims.Manager, domainPolicy *domainpolicy.Policy, approvalQueue *approvals.Queue) {
+	uid := c.Param("uid")
+
+	// Igual que en VerifyCode, un usuario verificado sin rol recibe el rol de su dominio o el por defecto,
+	// salvo que su registro requiera aprobación: en ese caso el rol lo asigna la aprobación
+	result, err := finishVerification(context.Background(), authClient, claimsManager, domainPolicy, approvalQueue, uid)
+	if auth.IsUserNotFound(err) {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Error al verificar el correo de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), map[string]interface{}{
+		"verified": true,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al marcar usuario %s como verificado en Firestore: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAdminVerifyEmail, SubjectUID: uid})
+	if result.ApprovalRequested {
+		audit.Record(c, audit.Event{Action: audit.ActionRegistrationRequest, SubjectUID: uid, Email: result.Email})
+		c.JSON(http.StatusOK, httputil.StandardResponse{
+			Message: "Usuario verificado. La cuenta está pendiente de aprobación.",
+			Data:    map[string]string{"state": LoginStatePendingApproval},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Usuario verificado"})
+}
+
+// AdminResendCode envía un nuevo código de verificación al usuario.
+//
+// @Summary Reenviar código de verificación
+// @Description Genera y envía un nuevo código de verificación al usuario, aunque el anterior siga vigente.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Código reenviado"
+// @Failure 400 {object} httputil.ErrorResponse "El usuario ya está verificado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid}/resend-code [post]
+func AdminResendCode(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	uid := c.Param("uid")
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "El usuario ya está verificado"})
+		return
+	}
+
+	if err := issueVerificationCode(firestoreClient, uid, user.Email); err != nil {
+		log.Printf("Error al reenviar el código de verificación a %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de verificación"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAdminResendCode, SubjectUID: uid})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Se ha enviado un nuevo correo de verificación."})
+}
+
+// AdminDeleteUser elimina de inmediato y de forma permanente la cuenta de un usuario.
+//
+// Usa el mismo trabajo reanudable que la eliminación solicitada por el usuario, pero sin plazo de gracia.
+//
+// @Summary Eliminar usuario
+// @Description Elimina de inmediato la cuenta de Firebase Auth, Firestore y Cloud Storage.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Usuario eliminado"
+// @Success 202 {object} httputil.StandardResponse "Eliminación incompleta, se reintentará"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/users/{uid} [delete]
+func AdminDeleteUser(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	uid := c.Param("uid")
+
+	// Una cuenta que ya perdió su registro de Auth a medio eliminar la retoma el proceso en segundo plano
+	if _, err := authClient.GetUser(context.Background(), uid); err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAdminUserDelete, SubjectUID: uid})
+	job, err := runAccountDeletion(context.Background(), firestoreClient, authClient, storageClient, uid)
+	if err != nil {
+		log.Printf("Error al eliminar la cuenta %s: %v", uid, err)
+		if job == nil {
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al eliminar la cuenta"})
+			return
+		}
+		c.JSON(http.StatusAccepted, httputil.StandardResponse{
+			Message: "La eliminación de la cuenta quedó incompleta y se reintentará automáticamente",
+			Data:    job,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Usuario eliminado correctamente",
+		Data:    job,
+	})
+}
+
+// parseAdminUserFilter lee los filtros del listado de usuarios desde la query.
+func parseAdminUserFilter(c *gin.Context) (adminUserFilter, error) {
+	var filter adminUserFilter
+
+	if value := c.Query("verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("Parámetro verified inválido")
+		}
+		filter.verified = &verified
+	}
+
+	filter.role = c.Query("role")
+
+	if value := c.Query("createdFrom"); value != "" {
+		createdFrom, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("Parámetro createdFrom inválido")
+		}
+		filter.createdFrom = createdFrom
+	}
+	if value := c.Query("createdTo"); value != "" {
+		createdTo, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("Parámetro createdTo inválido")
+		}
+		filter.createdTo = createdTo
+	}
+
+	return filter, nil
+}
+
+// matches indica si el usuario cumple todos los filtros.
+func (f adminUserFilter) matches(user *auth.UserRecord) bool {
+	if f.verified != nil && user.EmailVerified != *f.verified {
+		return false
+	}
+	if f.role != "" {
+		if role, _ := user.CustomClaims["role"].(string); role != f.role {
+			return false
+		}
+	}
+	if user.UserMetadata != nil {
+		createdAt := time.UnixMilli(user.UserMetadata.CreationTimestamp)
+		if !f.createdFrom.IsZero() && createdAt.Before(f.createdFrom) {
+			return false
+		}
+		if !f.createdTo.IsZero() && createdAt.After(f.createdTo) {
+			return false
+		}
+	}
+	return true
+}
+
+// adminUserSummary construye el resumen de un usuario para la API de administración.
+func adminUserSummary(user *auth.UserRecord) AdminUserSummary {
+	summary := AdminUserSummary{
+		UID:           user.UID,
+		Email:         user.Email,
+		DisplayName:   user.DisplayName,
+		EmailVerified: user.EmailVerified,
+		Disabled:      user.Disabled,
+		Role:          user.CustomClaims["role"],
+	}
+	if user.UserMetadata != nil {
+		summary.CreatedAt = time.UnixMilli(user.UserMetadata.CreationTimestamp)
+		if user.UserMetadata.LastLogInTimestamp > 0 {
+			lastLoginAt := time.UnixMilli(user.UserMetadata.LastLogInTimestamp)
+			summary.LastLoginAt = &lastLoginAt
+		}
+	}
+	return summary
+}
+
+// respondAdminUserError responde con 404 si el usuario no existe o con 500 en otro caso.
+func respondAdminUserError(c *gin.Context, uid string, err error) {
+	if auth.IsUserNotFound(err) {
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
+		return
+	}
+	log.Printf("Error en la administración del usuario %s: %v", uid, err)
+	c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+}
@@ -0,0 +1,180 @@
+// backend/api/controllers/api_keys.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/api/apikeys"
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// maxActiveAPIKeys limita cuántas API keys activas puede tener un usuario
+const maxActiveAPIKeys = 20
+
+// CreateAPIKeyRequest representa la solicitud para crear una API key
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateAPIKey crea un personal access token con los scopes indicados.
+//
+// El token completo solo se devuelve en esta respuesta; después solo se muestra su prefijo. Los scopes
+// deben estar dentro de los permisos efectivos del usuario, y al usarse se restringen además al rol
+// que el usuario tenga en ese momento.
+//
+// @Summary Crear API key
+// @Description Crea un personal access token (pat_...) con scopes y vencimiento opcional.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body CreateAPIKeyRequest true "Datos de la API key"
+// @Success 201 {object} httputil.StandardResponse "API key creada"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Scopes no permitidos"
+// @Failure 409 {object} httputil.ErrorResponse "Se alcanzó el máximo de API keys"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /api-keys [post]
+func CreateAPIKey(c *gin.Context, firestoreClient *firestore.Client) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "La fecha de vencimiento debe ser futura"})
+		return
+	}
+
+	authTok := c.MustGet("user").(*auth.Token)
+	role, _ := authTok.Claims["role"].(string)
+	granted := authz.Permissions().Effective(role, authTok.Claims)
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || containsString(scopes, scope) {
+			continue
+		}
+		if !containsString(granted, scope) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes el permiso " + scope})
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	ctx := context.Background()
+	store := apikeys.NewStore(firestoreClient)
+
+	existing, err := store.List(ctx, authTok.UID)
+	if err != nil {
+		log.Printf("Error al listar las API keys de %s: %v", authTok.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	active := 0
+	for _, key := range existing {
+		if key.Active(time.Now()) {
+			active++
+		}
+	}
+	if active >= maxActiveAPIKeys {
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "Alcanzaste el máximo de API keys activas"})
+		return
+	}
+
+	key, token, err := store.Create(ctx, authTok.UID, strings.TrimSpace(req.Name), scopes, req.ExpiresAt)
+	if err != nil {
+		log.Printf("Error al crear la API key de %s: %v", authTok.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al crear la API key"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAPIKeyCreate, Details: map[string]interface{}{"apiKeyId": key.ID, "scopes": scopes}})
+	c.JSON(http.StatusCreated, httputil.StandardResponse{
+		Message: "API key creada correctamente; guarda el token, no se volverá a mostrar",
+		Data: map[string]interface{}{
+			"token":  token,
+			"apiKey": key,
+		},
+	})
+}
+
+// ListAPIKeys lista las API keys del usuario autenticado, sin sus secretos.
+//
+// @Summary Listar API keys
+// @Description Lista las API keys del usuario con su prefijo, scopes, vencimiento y último uso.
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "API keys"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /api-keys [get]
+func ListAPIKeys(c *gin.Context, firestoreClient *firestore.Client) {
+	uid := c.MustGet("user").(*auth.Token).UID
+
+	keys, err := apikeys.NewStore(firestoreClient).List(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al listar las API keys de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "API keys obtenidas correctamente", Data: keys})
+}
+
+// RevokeAPIKey revoca una API key del usuario autenticado.
+//
+// @Summary Revocar API key
+// @Description Revoca la API key indicada; deja de aceptarse de inmediato.
+// @Tags api-keys
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param id path string true "ID de la API key"
+// @Success 200 {object} httputil.StandardResponse "API key revocada"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 404 {object} httputil.ErrorResponse "API key no encontrada"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context, firestoreClient *firestore.Client) {
+	uid := c.MustGet("user").(*auth.Token).UID
+
+	err := apikeys.NewStore(firestoreClient).Revoke(context.Background(), uid, c.Param("id"))
+	if errors.Is(err, apikeys.ErrNotFound) {
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "API key no encontrada"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error al revocar la API key %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAPIKeyRevoke, Details: map[string]interface{}{"apiKeyId": c.Param("id")}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "API key revocada correctamente"})
+}
@@ -0,0 +1,258 @@
+// backend/api/controllers/approvals.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend/api/approvals"
+	"backend/api/audit"
+	"backend/api/claims"
+	"backend/api/domainpolicy"
+	"backend/api/httputil"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// Códigos de error del flujo de aprobación de registros
+const (
+	ErrCodeAccountPendingApproval = "account_pending_approval"
+	ErrCodeRegistrationRejected   = "registration_rejected"
+)
+
+// LoginStatePendingApproval indica que el correo se verificó pero la cuenta espera la aprobación de un administrador
+const LoginStatePendingApproval = "pending_approval"
+
+var (
+	approvalRequestedT    *template.Template
+	approvalPendingT      *template.Template
+	registrationApprovedT *template.Template
+	registrationRejectedT *template.Template
+)
+
+func init() {
+	approvalRequestedT = template.Must(template.ParseFiles("html/approval_requested.html"))
+	approvalPendingT = template.Must(template.ParseFiles("html/approval_pending.html"))
+	registrationApprovedT = template.Must(template.ParseFiles("html/registration_approved.html"))
+	registrationRejectedT = template.Must(template.ParseFiles("html/registration_rejected.html"))
+}
+
+// RejectRegistrationRequest contiene el motivo del rechazo, que se envía al solicitante
+type RejectRegistrationRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// AdminListApprovals lista las solicitudes de aprobación de registros.
+//
+// @Summary Listar solicitudes de aprobación
+// @Description Lista las solicitudes de aprobación de registros con el estado indicado (por defecto pending), de la más antigua a la más nueva.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param status query string false "pending, approved o rejected"
+// @Success 200 {object} httputil.StandardResponse "Solicitudes obtenidas"
+// @Failure 400 {object} httputil.ErrorResponse "Estado inválido"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/approvals [get]
+func AdminListApprovals(c *gin.Context, queue *approvals.Queue) {
+	wanted := c.DefaultQuery("status", approvals.StatusPending)
+	switch wanted {
+	case approvals.StatusPending, approvals.StatusApproved, approvals.StatusRejected:
+	default:
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Estado inválido"})
+		return
+	}
+
+	list, err := queue.List(context.Background(), wanted)
+	if err != nil {
+		log.Printf("Error al listar las solicitudes de aprobación: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Solicitudes obtenidas correctamente", Data: list})
+}
+
+// AdminApproveRegistration aprueba el registro de un usuario y le asigna su rol.
+//
+// @Summary Aprobar registro
+// @Description Aprueba una solicitud pendiente, asigna al usuario el rol de su dominio (o el de menor privilegio) y le avisa por correo.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Registro aprobado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Solicitud no encontrada"
+// @Failure 409 {object} httputil.ErrorResponse "La solicitud ya fue resuelta"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/approvals/{uid}/approve [post]
+func AdminApproveRegistration(c *gin.Context, queue *approvals.Queue, claimsManager *claims.Manager, domainPolicy *domainpolicy.Policy) {
+	uid := c.Param("uid")
+
+	approval, err := queue.Get(context.Background(), uid)
+	if err == nil && approval.Status != approvals.StatusPending {
+		err = approvals.ErrNotPending
+	}
+	if err != nil {
+		respondApprovalError(c, uid, err)
+		return
+	}
+
+	// El rol se asigna antes de resolver la solicitud para que, si falla, se pueda volver a aprobar
+	role := domainPolicy.RoleFor(approval.Email)
+	if _, err := claimsManager.Set(context.Background(), uid, claims.KeyRole, role); err != nil {
+		log.Printf("Error al asignar el rol al usuario aprobado %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	actorUID := c.MustGet("user").(*auth.Token).UID
+	if approval, err = queue.Decide(context.Background(), uid, actorUID, true, ""); err != nil {
+		respondApprovalError(c, uid, err)
+		return
+	}
+
+	go func() {
+		data := struct {
+			Email     string
+			LoginLink string
+			Year      int
+		}{
+			Email:     approval.Email,
+			LoginLink: fmt.Sprintf("%s/login", os.Getenv("URL_FRONTEND")),
+			Year:      time.Now().Year(),
+		}
+		if err := sendTemplateMail(registrationApprovedT, approval.Email, "Tu cuenta fue aprobada", data); err != nil {
+			log.Printf("Error al avisar la aprobación a %s: %v", approval.Email, err)
+		}
+	}()
+
+	audit.Record(c, audit.Event{Action: audit.ActionRegistrationApprove, SubjectUID: uid, Email: approval.Email, Details: map[string]interface{}{"role": role}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Registro aprobado correctamente", Data: approval})
+}
+
+// AdminRejectRegistration rechaza el registro de un usuario y desactiva su cuenta.
+//
+// @Summary Rechazar registro
+// @Description Rechaza una solicitud pendiente con un motivo, desactiva la cuenta y envía el motivo al solicitante.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param uid path string true "UID del usuario"
+// @Param body body RejectRegistrationRequest true "Motivo del rechazo"
+// @Success 200 {object} httputil.StandardResponse "Registro rechazado"
+// @Failure 400 {object} httputil.ErrorResponse "Falta el motivo"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Solicitud no encontrada"
+// @Failure 409 {object} httputil.ErrorResponse "La solicitud ya fue resuelta"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/approvals/{uid}/reject [post]
+func AdminRejectRegistration(c *gin.Context, queue *approvals.Queue, authClient *auth.Client) {
+	uid := c.Param("uid")
+
+	var req RejectRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Se requiere el motivo del rechazo"})
+		return
+	}
+
+	actorUID := c.MustGet("user").(*auth.Token).UID
+	approval, err := queue.Decide(context.Background(), uid, actorUID, false, strings.TrimSpace(req.Reason))
+	if err != nil {
+		respondApprovalError(c, uid, err)
+		return
+	}
+
+	if _, err := authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Disabled(true)); err != nil {
+		log.Printf("Error al desactivar la cuenta rechazada %s: %v", uid, err)
+	}
+	if err := authClient.RevokeRefreshTokens(context.Background(), uid); err != nil {
+		log.Printf("Advertencia: no se pudieron revocar las sesiones del usuario %s: %v", uid, err)
+	}
+
+	go func() {
+		data := struct {
+			Email  string
+			Reason string
+			Year   int
+		}{
+			Email:  approval.Email,
+			Reason: approval.Reason,
+			Year:   time.Now().Year(),
+		}
+		if err := sendTemplateMail(registrationRejectedT, approval.Email, "Tu solicitud de cuenta fue rechazada", data); err != nil {
+			log.Printf("Error al avisar el rechazo a %s: %v", approval.Email, err)
+		}
+	}()
+
+	audit.Record(c, audit.Event{Action: audit.ActionRegistrationReject, SubjectUID: uid, Email: approval.Email, Details: map[string]interface{}{"reason": approval.Reason}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Registro rechazado correctamente", Data: approval})
+}
+
+// requestApproval deja la cuenta recién verificada pendiente de aprobación y avisa a los aprobadores y
+// al solicitante
+func requestApproval(queue *approvals.Queue, uid, email string) error {
+	approval, err := queue.Request(context.Background(), uid, email)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		frontend := os.Getenv("URL_FRONTEND")
+		for _, approver := range queue.Approvers {
+			data := struct {
+				Email      string
+				Time       time.Time
+				ReviewLink string
+				Year       int
+			}{
+				Email:      email,
+				Time:       approval.RequestedAt,
+				ReviewLink: fmt.Sprintf("%s/admin/approvals", frontend),
+				Year:       time.Now().Year(),
+			}
+			if err := sendTemplateMail(approvalRequestedT, approver, "Registro pendiente de aprobación", data); err != nil {
+				log.Printf("Error al avisar la solicitud de %s al aprobador %s: %v", uid, approver, err)
+			}
+		}
+
+		data := struct {
+			Email string
+			Year  int
+		}{
+			Email: email,
+			Year:  time.Now().Year(),
+		}
+		if err := sendTemplateMail(approvalPendingT, email, "Tu cuenta está pendiente de aprobación", data); err != nil {
+			log.Printf("Error al avisar a %s que su cuenta está pendiente de aprobación: %v", email, err)
+		}
+	}()
+	return nil
+}
+
+// respondApprovalError traduce los errores de la cola de aprobación a respuestas HTTP
+func respondApprovalError(c *gin.Context, uid string, err error) {
+	switch {
+	case errors.Is(err, approvals.ErrNotFound):
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Solicitud de aprobación no encontrada"})
+	case errors.Is(err, approvals.ErrNotPending):
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La solicitud de aprobación ya fue resuelta"})
+	default:
+		log.Printf("Error en la solicitud de aprobación de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+	}
+}
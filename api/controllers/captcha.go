@@ -0,0 +1,49 @@
+// backend/api/controllers/captcha.go
+
+package controllers
+
+import (
+	"log"
+	"net/http"
+
+	"backend/api/captcha"
+	"backend/api/httputil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCaptcha devuelve el CAPTCHA que exigen /register y /forgot-password. Con el proveedor "pow" incluye
+// un desafío nuevo de prueba de trabajo.
+//
+// @Summary Obtener CAPTCHA
+// @Description Indica el proveedor de CAPTCHA configurado y su clave pública o, con prueba de trabajo, un desafío que se debe resolver. El token se envía en el encabezado X-Captcha-Token o en el campo captchaToken.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} httputil.StandardResponse "CAPTCHA configurado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /captcha [get]
+func GetCaptcha(c *gin.Context, verifier captcha.Verifier) {
+	if verifier == nil {
+		c.JSON(http.StatusOK, httputil.StandardResponse{
+			Message: "CAPTCHA desactivado",
+			Data:    map[string]interface{}{"info": captcha.Info{Provider: "none"}},
+		})
+		return
+	}
+
+	data := map[string]interface{}{"info": verifier.Info()}
+	if challenger, ok := verifier.(captcha.Challenger); ok {
+		challenge, err := challenger.Challenge()
+		if err != nil {
+			log.Printf("Error al generar el desafío del CAPTCHA: %v", err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar el desafío"})
+			return
+		}
+		data["challenge"] = challenge
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "CAPTCHA configurado",
+		Data:    data,
+	})
+}
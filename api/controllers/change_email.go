@@ -0,0 +1,348 @@
+// backend/api/controllers/change_email.go
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/domainpolicy"
+	"backend/api/httputil"
+	"backend/api/notifications"
+	"backend/api/utils"
+	"backend/api/verification"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var changeEmailCodeT *template.Template
+
+func init() {
+	// Cargar el template del código de confirmación del cambio de correo electrónico
+	changeEmailCodeT = template.Must(template.ParseFiles("html/change_email_code.html"))
+}
+
+// emailUndoWindow es el tiempo durante el cual se puede deshacer un cambio de correo desde la dirección anterior
+const emailUndoWindow = 72 * time.Hour
+
+// ChangeEmailRequest representa la solicitud de cambio de correo electrónico
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest representa la confirmación del cambio con el código enviado a la nueva dirección
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// UndoEmailChangeRequest representa la solicitud para deshacer un cambio de correo
+type UndoEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ChangeEmail inicia el cambio de correo electrónico del usuario autenticado.
+//
+// Envía un código de confirmación a la nueva dirección. El correo no se modifica en Firebase Auth
+// ni en Firestore hasta que el código se confirme en POST /change-email/confirm. La nueva dirección debe
+// cumplir la misma política de dominios que el registro.
+//
+// @Summary Cambiar correo electrónico
+// @Description Envía un código de confirmación a la nueva dirección de correo del usuario autenticado.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body ChangeEmailRequest true "Nuevo correo electrónico"
+// @Success 200 {object} httputil.StandardResponse "Código de confirmación enviado"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos o dominio no permitido"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado o se requiere volver a autenticarse"
+// @Failure 409 {object} httputil.ErrorResponse "El correo electrónico ya está en uso"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /change-email [post]
+func ChangeEmail(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, domainPolicy *domainpolicy.Policy) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	newEmail := strings.ToLower(strings.TrimSpace(req.NewEmail))
+	if addr, err := mail.ParseAddress(newEmail); err != nil || addr.Address != newEmail {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Correo electrónico inválido"})
+		return
+	}
+	if err := domainPolicy.Check(context.Background(), newEmail); err != nil {
+		respondDomainPolicyError(c, "newEmail", err)
+		return
+	}
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al obtener usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener información del usuario"})
+		return
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "El nuevo correo es igual al actual"})
+		return
+	}
+
+	inUse, err := emailInUse(authClient, newEmail)
+	if err != nil {
+		log.Printf("Error al verificar el correo %s: %v", newEmail, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "El correo electrónico ya está en uso"})
+		return
+	}
+
+	code, codeFields, err := verification.EmailChange.Issue(uid, 30*time.Minute)
+	if err != nil {
+		log.Printf("Error al generar el código de cambio de correo: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	codeFields["pendingEmail"] = newEmail
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), codeFields, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al guardar el cambio de correo pendiente: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	data := struct {
+		Code  string
+		Email string
+		Year  int
+	}{
+		Code:  code,
+		Email: newEmail,
+		Year:  time.Now().Year(),
+	}
+	if err := sendTemplateMail(changeEmailCodeT, newEmail, "Confirma tu nuevo correo", data); err != nil {
+		log.Printf("Error al enviar el código de cambio de correo: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el código de confirmación"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionEmailChangeRequest, Details: map[string]interface{}{"newEmail": newEmail}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Se ha enviado un código de confirmación al nuevo correo electrónico.",
+	})
+}
+
+// ConfirmEmailChange confirma el cambio de correo electrónico con el código enviado a la nueva dirección.
+//
+// Actualiza Firebase Auth y el documento users/{uid}, y notifica a la dirección anterior con un enlace
+// para deshacer el cambio durante 72 horas.
+//
+// @Summary Confirmar cambio de correo
+// @Description Confirma el cambio de correo con el código recibido y notifica a la dirección anterior.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body ConfirmEmailChangeRequest true "Código de confirmación"
+// @Success 200 {object} httputil.StandardResponse "Correo electrónico actualizado"
+// @Failure 400 {object} httputil.ErrorResponse "Código inválido o expirado"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 409 {object} httputil.ErrorResponse "El correo electrónico ya está en uso"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /change-email/confirm [post]
+func ConfirmEmailChange(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	// El código se consume en una transacción; si un paso posterior falla, se debe solicitar otro
+	userRef := firestoreClient.Collection("users").Doc(uid)
+	var newEmail string
+	err := verification.EmailChange.Verify(context.Background(), firestoreClient, userRef, uid, req.Code, func(data map[string]interface{}) (map[string]interface{}, error) {
+		newEmail, _ = data["pendingEmail"].(string)
+		if newEmail == "" {
+			return nil, verification.ErrNoCode
+		}
+		return nil, nil
+	})
+	if err != nil {
+		respondCodeError(c, err, "confirmación", "No hay un cambio de correo pendiente")
+		return
+	}
+
+	// El correo pudo haber sido tomado por otra cuenta mientras el cambio estaba pendiente
+	inUse, err := emailInUse(authClient, newEmail)
+	if err != nil {
+		log.Printf("Error al verificar el correo %s: %v", newEmail, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "El correo electrónico ya está en uso"})
+		return
+	}
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al obtener usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener información del usuario"})
+		return
+	}
+	oldEmail := user.Email
+
+	_, err = authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Email(newEmail).EmailVerified(true))
+	if err != nil {
+		log.Printf("Error al actualizar el correo en Firebase Auth: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar el correo electrónico"})
+		return
+	}
+
+	// El ID del cambio permite invalidar el enlace para deshacer si se vuelve a cambiar el correo
+	undoID := uuid.New().String()
+	_, err = userRef.Set(context.Background(), map[string]interface{}{
+		"email":        newEmail,
+		"emailUndoID":  undoID,
+		"pendingEmail": firestore.Delete,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al actualizar el correo en Firestore: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar el correo electrónico"})
+		return
+	}
+
+	// Notificar a la dirección anterior con un enlace para deshacer el cambio
+	if oldEmail != "" {
+		undoToken, err := utils.GenerarTokenConProposito(oldEmail, uid, utils.PurposeEmailUndo, undoID, emailUndoWindow)
+		if err != nil {
+			log.Printf("Error al generar el token para deshacer el cambio de correo: %v", err)
+		} else {
+			details := notifications.Details{
+				OldEmail: oldEmail,
+				NewEmail: newEmail,
+				UndoLink: fmt.Sprintf("%s/undo-email-change?token=%s", os.Getenv("URL_FRONTEND"), undoToken),
+			}
+			if err := notifications.NewNotifier(firestoreClient).Notify(context.Background(), uid, oldEmail, notifications.EventEmailChanged, details); err != nil {
+				log.Printf("Error al notificar el cambio de correo a %s: %v", oldEmail, err)
+			}
+		}
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionEmailChange, Details: map[string]interface{}{"oldEmail": oldEmail, "newEmail": newEmail}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Correo electrónico actualizado correctamente",
+		Data:    map[string]string{"uid": uid, "email": newEmail},
+	})
+}
+
+// UndoEmailChange restaura el correo anterior usando el enlace enviado a esa dirección.
+//
+// Como el cambio pudo no haber sido hecho por el dueño de la cuenta, también se revocan las sesiones activas.
+//
+// @Summary Deshacer cambio de correo
+// @Description Restaura el correo electrónico anterior con el token enviado a esa dirección (válido por 72 horas).
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param body body UndoEmailChangeRequest true "Token para deshacer el cambio"
+// @Success 200 {object} httputil.StandardResponse "Correo electrónico restaurado"
+// @Failure 400 {object} httputil.ErrorResponse "Token inválido o expirado"
+// @Failure 409 {object} httputil.ErrorResponse "El correo electrónico ya está en uso"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /change-email/undo [post]
+func UndoEmailChange(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	var req UndoEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	claims, err := utils.VerificarTokenConProposito(req.Token, utils.PurposeEmailUndo)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Token inválido o expirado"})
+		return
+	}
+
+	userRef := firestoreClient.Collection("users").Doc(claims.UID)
+	doc, err := userRef.Get(context.Background())
+	if err != nil {
+		log.Printf("Error al obtener datos del usuario %s: %v", claims.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener datos del usuario"})
+		return
+	}
+	if undoID, _ := doc.Data()["emailUndoID"].(string); undoID == "" || undoID != claims.Id {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Token inválido o expirado"})
+		return
+	}
+
+	// La dirección anterior pudo haber sido registrada por otra cuenta en el intertanto
+	if existing, err := authClient.GetUserByEmail(context.Background(), claims.Email); err == nil && existing.UID != claims.UID {
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "El correo electrónico ya está en uso"})
+		return
+	}
+
+	_, err = authClient.UpdateUser(context.Background(), claims.UID, (&auth.UserToUpdate{}).Email(claims.Email).EmailVerified(true))
+	if err != nil {
+		log.Printf("Error al restaurar el correo en Firebase Auth: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al restaurar el correo electrónico"})
+		return
+	}
+
+	_, err = userRef.Set(context.Background(), map[string]interface{}{
+		"email":       claims.Email,
+		"emailUndoID": firestore.Delete,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al restaurar el correo en Firestore: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al restaurar el correo electrónico"})
+		return
+	}
+
+	if err := authClient.RevokeRefreshTokens(context.Background(), claims.UID); err != nil {
+		log.Printf("Advertencia: no se pudieron revocar las sesiones del usuario %s: %v", claims.UID, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionEmailChangeUndo, SubjectUID: claims.UID, Email: claims.Email})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Correo electrónico restaurado. Por seguridad, vuelve a iniciar sesión y cambia tu contraseña.",
+	})
+}
+
+// emailInUse indica si el correo ya pertenece a una cuenta de Firebase Auth.
+func emailInUse(authClient *auth.Client, email string) (bool, error) {
+	_, err := authClient.GetUserByEmail(context.Background(), email)
+	if err == nil {
+		return true, nil
+	}
+	if auth.IsUserNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
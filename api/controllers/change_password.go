@@ -1,11 +1,17 @@
 package controllers
 
 import (
+	"backend/api/audit"
 	"backend/api/httputil"
+	"backend/api/notifications"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
 	"backend/api/utils"
 	"context"
+	"log"
 	"net/http"
 
+	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
 )
@@ -27,12 +33,12 @@ type ChangePasswordRequest struct {
 // @Param Authorization header string true "Bearer Token"
 // @Param body body ChangePasswordRequest true "Nueva contraseña del usuario"
 // @Success 200 {object} httputil.StandardResponse "Contraseña actualizada correctamente"
-// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos, contraseña que no cumple la política o ya usada recientemente"
 // @Failure 401 {object} httputil.ErrorResponse "Token de autenticación no proporcionado o inválido"
 // @Failure 403 {object} httputil.ErrorResponse "Token de autenticación expirado"
 // @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
 // @Router /change-password [post]
-func ChangePassword(c *gin.Context, authClient *auth.Client) {
+func ChangePassword(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store) {
 	// Obtener el cliente del middleware JWT
 	claims, _ := c.Get("claims")
 	if claims == nil {
@@ -40,6 +46,12 @@ func ChangePassword(c *gin.Context, authClient *auth.Client) {
 		return
 	}
 
+	// Solo se aceptan tokens emitidos para restablecer la contraseña
+	if claims.(*utils.Claims).Purpose != utils.PurposePasswordReset {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "Token inválido para esta operación"})
+		return
+	}
+
 	// Obtener el UID del usuario
 	uid := claims.(*utils.Claims).UID
 
@@ -56,15 +68,86 @@ func ChangePassword(c *gin.Context, authClient *auth.Client) {
 		return
 	}
 
-	// Actualizar la contraseña usando el cliente de autenticación Firebase
-	_, err := authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Password(req.Password))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar la contraseña"})
+	if !applyPasswordChange(c, firestoreClient, authClient, passwordPolicy, passwordHistory, uid, claims.(*utils.Claims).Email, req.Password) {
 		return
 	}
 
+	// Si la cuenta fue bloqueada desde una notificación, el cambio de contraseña la reactiva
+	if err := unlockAfterPasswordReset(context.Background(), firestoreClient, authClient, uid); err != nil {
+		log.Printf("Error al reactivar la cuenta bloqueada %s: %v", uid, err)
+	}
+
 	// Respuesta exitosa
 	c.JSON(http.StatusOK, httputil.StandardResponse{
 		Message: "Contraseña actualizada correctamente",
 	})
 }
+
+// UpdatePassword cambia la contraseña del usuario con sesión iniciada.
+//
+// A diferencia de /change-password, que usa el token del correo de restablecimiento, este endpoint usa la
+// sesión de Firebase y exige una autenticación reciente (POST /reauthenticate).
+//
+// @Summary Cambiar contraseña con la sesión
+// @Description Cambia la contraseña del usuario autenticado. Requiere haberse autenticado en los últimos minutos.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body ChangePasswordRequest true "Nueva contraseña del usuario"
+// @Success 200 {object} httputil.StandardResponse "Contraseña actualizada correctamente"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos, contraseña que no cumple la política o ya usada recientemente"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado o se requiere re-autenticación (reauthentication_required)"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /password [put]
+func UpdatePassword(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: err.Error()})
+		return
+	}
+
+	token := c.MustGet("user").(*auth.Token)
+	email, _ := token.Claims["email"].(string)
+	if !applyPasswordChange(c, firestoreClient, authClient, passwordPolicy, passwordHistory, token.UID, email, req.Password) {
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Contraseña actualizada correctamente",
+	})
+}
+
+// applyPasswordChange valida la nueva contraseña contra la política y el historial, la guarda en Firebase
+// y avisa al usuario. Si falla, ya respondió la solicitud y devuelve false.
+func applyPasswordChange(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store, uid, email, password string) bool {
+	var displayName string
+	if user, err := authClient.GetUser(context.Background(), uid); err == nil {
+		displayName = user.DisplayName
+		if email == "" {
+			email = user.Email
+		}
+	}
+	userInputs := []string{email, displayName}
+	if !checkPasswordPolicy(c, passwordPolicy, "password", password, userInputs...) {
+		return false
+	}
+	if !checkPasswordHistory(c, passwordHistory, uid, "password", password) {
+		return false
+	}
+
+	// Actualizar la contraseña usando el cliente de autenticación Firebase
+	_, err := authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Password(password))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar la contraseña"})
+		return false
+	}
+	recordPassword(passwordHistory, uid, password)
+
+	if err := notifications.NewNotifier(firestoreClient).Notify(context.Background(), uid, email, notifications.EventPasswordChanged, notifications.Details{}); err != nil {
+		log.Printf("Error al notificar el cambio de contraseña de %s: %v", uid, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionPasswordChange, ActorUID: uid, SubjectUID: uid})
+	return true
+}
@@ -0,0 +1,634 @@
+// backend/api/controllers/delete_account.go
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"backend/api/apikeys"
+	"backend/api/approvals"
+	"backend/api/audit"
+	"backend/api/httputil"
+	"backend/api/lockout"
+	"backend/api/orgs"
+	"backend/api/utils"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	accountDeletedT           *template.Template
+	accountDeletionScheduledT *template.Template
+)
+
+func init() {
+	// Cargar los templates de eliminación y restauración de cuenta
+	accountDeletedT = template.Must(template.ParseFiles("html/account_deleted.html"))
+	accountDeletionScheduledT = template.Must(template.ParseFiles("html/account_deletion_scheduled.html"))
+}
+
+// accountDeletionGracePeriod es el plazo durante el cual una cuenta marcada para eliminación se puede restaurar
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// ErrCodeAccountScheduledForDeletion es el código de error que recibe un inicio de sesión durante el plazo de gracia
+const ErrCodeAccountScheduledForDeletion = "account_scheduled_for_deletion"
+
+// Estados de un trabajo de eliminación de cuenta en account_deletions/{uid}
+const (
+	DeletionStatusScheduled = "scheduled"
+	DeletionStatusRunning   = "running"
+	DeletionStatusFailed    = "failed"
+	DeletionStatusCompleted = "completed"
+)
+
+// Pasos de la eliminación, en el orden en que se ejecutan. La cuenta de Firebase Auth se elimina
+// al final para no dejar datos huérfanos de una cuenta que ya no existe.
+var deletionSteps = []string{"storage", "exports", "password_resets", "login_attempts", "approvals", "api_keys", "organizations", "subcollections", "profile", "auth", "email"}
+
+// AccountDeletionJob representa el progreso de la eliminación de una cuenta
+type AccountDeletionJob struct {
+	UID         string          `firestore:"uid" json:"uid"`
+	Email       string          `firestore:"email" json:"email"`
+	Status      string          `firestore:"status" json:"status"`
+	Steps       map[string]bool `firestore:"steps" json:"steps"`
+	LastError   string          `firestore:"lastError" json:"lastError,omitempty"`
+	Attempts    int             `firestore:"attempts" json:"attempts"`
+	PurgeAt     time.Time       `firestore:"purgeAt" json:"purgeAt"`
+	RestoreID   string          `firestore:"restoreID" json:"-"`
+	CreatedAt   time.Time       `firestore:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time       `firestore:"updatedAt" json:"updatedAt"`
+	CompletedAt *time.Time      `firestore:"completedAt" json:"completedAt,omitempty"`
+	// DisabledByAdmin indica que un administrador desactivó la cuenta durante el plazo de gracia; la
+	// restauración cancela la eliminación pero no la reactiva
+	DisabledByAdmin bool `firestore:"disabledByAdmin" json:"-"`
+}
+
+// statusBeforeDeletionField guarda en users/{uid} el estado que tenía la cuenta antes de programar su
+// eliminación, para devolverlo al restaurarla
+const statusBeforeDeletionField = "statusBeforeDeletion"
+
+// RestoreAccountRequest representa la solicitud para restaurar una cuenta marcada para eliminación
+type RestoreAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DeleteAccount marca para eliminación la cuenta del usuario autenticado.
+//
+// La cuenta se desactiva en Firebase Auth y se puede restaurar durante 30 días con el enlace enviado
+// por correo. Al vencer el plazo, un proceso en segundo plano elimina las fotos en profile_photos/{uid}/,
+// las exportaciones en exports/{uid}/, las solicitudes en password_resets, el documento users/{uid} con sus subcolecciones y el usuario de
+// Firebase Auth. El progreso se guarda en account_deletions/{uid}, por lo que si un paso falla la
+// eliminación se retoma desde ese punto; al terminar, ese documento también se elimina para no conservar
+// datos personales de la cuenta.
+//
+// @Summary Eliminar cuenta
+// @Description Desactiva la cuenta del usuario autenticado y la elimina de forma permanente tras 30 días.
+// @Tags account
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Cuenta marcada para eliminación"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado o se requiere volver a autenticarse"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /account [delete]
+func DeleteAccount(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	job, err := scheduleAccountDeletion(context.Background(), firestoreClient, authClient, uid)
+	if err != nil {
+		log.Printf("Error al marcar la cuenta %s para eliminación: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al eliminar la cuenta"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAccountDeletionRequest, Details: map[string]interface{}{"purgeAt": job.PurgeAt}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: fmt.Sprintf("La cuenta será eliminada el %s. Te enviamos un enlace para restaurarla antes de esa fecha.", job.PurgeAt.Format("02-01-2006")),
+		Data:    job,
+	})
+}
+
+// RestoreAccount restaura una cuenta marcada para eliminación usando el enlace enviado por correo.
+//
+// @Summary Restaurar cuenta
+// @Description Reactiva una cuenta marcada para eliminación si aún no vence el plazo de 30 días.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param body body RestoreAccountRequest true "Token de restauración"
+// @Success 200 {object} httputil.StandardResponse "Cuenta restaurada"
+// @Failure 400 {object} httputil.ErrorResponse "Token inválido o expirado"
+// @Failure 409 {object} httputil.ErrorResponse "La cuenta ya no se puede restaurar"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /account/restore [post]
+func RestoreAccount(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	claims, err := utils.VerificarTokenConProposito(req.Token, utils.PurposeAccountRestore)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Token inválido o expirado"})
+		return
+	}
+
+	ctx := context.Background()
+	job, err := cancelAccountDeletion(ctx, firestoreClient, claims.UID, claims.Id)
+	if err != nil {
+		if err == errAccountNotRestorable || status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La cuenta ya no se puede restaurar"})
+			return
+		}
+		log.Printf("Error al restaurar la cuenta %s: %v", claims.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al restaurar la cuenta"})
+		return
+	}
+
+	// Si un administrador desactivó la cuenta durante el plazo, la restauración no deshace esa decisión
+	if job.DisabledByAdmin {
+		audit.Record(c, audit.Event{Action: audit.ActionAccountRestore, ActorUID: claims.UID, SubjectUID: claims.UID, Details: map[string]interface{}{"disabledByAdmin": true}})
+		c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Se canceló la eliminación de la cuenta, pero sigue desactivada por un administrador."})
+		return
+	}
+
+	if _, err := authClient.UpdateUser(ctx, claims.UID, (&auth.UserToUpdate{}).Disabled(false)); err != nil {
+		log.Printf("Error al reactivar la cuenta %s en Firebase Auth: %v", claims.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al restaurar la cuenta"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAccountRestore, ActorUID: claims.UID, SubjectUID: claims.UID})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Cuenta restaurada correctamente. Ya puedes iniciar sesión."})
+}
+
+// errAccountNotRestorable indica que la cuenta ya no está en el plazo de restauración
+var errAccountNotRestorable = fmt.Errorf("la cuenta no está marcada para eliminación")
+
+// cancelAccountDeletion cancela el trabajo de eliminación programado de la cuenta y devuelve al perfil el
+// estado que tenía antes de programarlo. Con restoreID vacío no se compara el enlace de restauración.
+// Devuelve errAccountNotRestorable si el trabajo ya no está programado y un error NotFound si no existe.
+func cancelAccountDeletion(ctx context.Context, firestoreClient *firestore.Client, uid, restoreID string) (*AccountDeletionJob, error) {
+	jobRef := firestoreClient.Collection("account_deletions").Doc(uid)
+	userRef := firestoreClient.Collection("users").Doc(uid)
+
+	var job AccountDeletionJob
+	// La transacción evita restaurar una cuenta que el proceso de purga ya comenzó a eliminar
+	err := firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(jobRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&job); err != nil {
+			return err
+		}
+		if job.Status != DeletionStatusScheduled || (restoreID != "" && job.RestoreID != restoreID) {
+			return errAccountNotRestorable
+		}
+
+		var previousStatus interface{} = firestore.Delete
+		userDoc, err := tx.Get(userRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if value, _ := userDoc.Data()[statusBeforeDeletionField].(string); value != "" {
+				previousStatus = value
+			}
+		}
+
+		if err := tx.Delete(jobRef); err != nil {
+			return err
+		}
+		return tx.Set(userRef, map[string]interface{}{
+			"status":                  previousStatus,
+			"deletionPurgeAt":         firestore.Delete,
+			statusBeforeDeletionField: firestore.Delete,
+		}, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// markDeletionDisabledByAdmin registra en el trabajo de eliminación programado, si existe, que un
+// administrador desactivó la cuenta
+func markDeletionDisabledByAdmin(ctx context.Context, firestoreClient *firestore.Client, uid string) error {
+	_, err := firestoreClient.Collection("account_deletions").Doc(uid).Update(ctx, []firestore.Update{
+		{Path: "disabledByAdmin", Value: true},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// scheduleAccountDeletion desactiva la cuenta, registra el trabajo de eliminación con su fecha de purga
+// y envía al usuario el enlace para restaurarla.
+func scheduleAccountDeletion(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, uid string) (*AccountDeletionJob, error) {
+	user, err := authClient.GetUser(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el usuario: %v", err)
+	}
+
+	now := time.Now()
+	job := &AccountDeletionJob{
+		UID:       uid,
+		Email:     user.Email,
+		Status:    DeletionStatusScheduled,
+		Steps:     map[string]bool{},
+		PurgeAt:   now.Add(accountDeletionGracePeriod),
+		RestoreID: uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	jobRef := firestoreClient.Collection("account_deletions").Doc(uid)
+	if _, err := jobRef.Set(ctx, job); err != nil {
+		return nil, fmt.Errorf("error al guardar el trabajo de eliminación: %v", err)
+	}
+
+	if _, err := authClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(true)); err != nil {
+		// Sin desactivar la cuenta el trabajo no debe quedar programado, o el purgador eliminaría una
+		// cuenta activa
+		if _, deleteErr := jobRef.Delete(ctx); deleteErr != nil {
+			log.Printf("Error al cancelar el trabajo de eliminación del usuario %s: %v", uid, deleteErr)
+		}
+		return nil, fmt.Errorf("error al desactivar el usuario: %v", err)
+	}
+	if err := authClient.RevokeRefreshTokens(ctx, uid); err != nil {
+		log.Printf("Advertencia: no se pudieron revocar las sesiones del usuario %s: %v", uid, err)
+	}
+
+	// El estado anterior (por ejemplo, pendiente de aprobación) se devuelve al restaurar la cuenta
+	profile := map[string]interface{}{
+		"status":          "pending_deletion",
+		"deletionPurgeAt": job.PurgeAt,
+	}
+	if doc, err := firestoreClient.Collection("users").Doc(uid).Get(ctx); err == nil {
+		if previousStatus, _ := doc.Data()["status"].(string); previousStatus != "" && previousStatus != "pending_deletion" {
+			profile[statusBeforeDeletionField] = previousStatus
+		}
+	}
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(ctx, profile, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Advertencia: no se pudo actualizar el perfil del usuario %s: %v", uid, err)
+	}
+
+	if job.Email != "" {
+		restoreToken, err := utils.GenerarTokenConProposito(job.Email, uid, utils.PurposeAccountRestore, job.RestoreID, accountDeletionGracePeriod)
+		if err != nil {
+			return job, fmt.Errorf("error al generar el token de restauración: %v", err)
+		}
+		data := struct {
+			Email       string
+			PurgeDate   string
+			RestoreLink string
+			Year        int
+		}{
+			Email:       job.Email,
+			PurgeDate:   job.PurgeAt.Format("02-01-2006"),
+			RestoreLink: fmt.Sprintf("%s/restore-account?token=%s", os.Getenv("URL_FRONTEND"), restoreToken),
+			Year:        now.Year(),
+		}
+		if err := sendTemplateMail(accountDeletionScheduledT, job.Email, "Tu cuenta será eliminada", data); err != nil {
+			log.Printf("Error al enviar el enlace de restauración a %s: %v", job.Email, err)
+		}
+	}
+
+	return job, nil
+}
+
+// scheduledDeletionFor devuelve el trabajo de eliminación programado del usuario, o nil si no tiene uno.
+func scheduledDeletionFor(ctx context.Context, firestoreClient *firestore.Client, uid string) (*AccountDeletionJob, error) {
+	doc, err := firestoreClient.Collection("account_deletions").Doc(uid).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var job AccountDeletionJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, err
+	}
+	if job.Status != DeletionStatusScheduled {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+// runAccountDeletion ejecuta (o retoma) la eliminación de la cuenta uid y devuelve el estado del trabajo.
+func runAccountDeletion(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client, uid string) (*AccountDeletionJob, error) {
+	jobRef := firestoreClient.Collection("account_deletions").Doc(uid)
+
+	job, err := loadOrCreateDeletionJob(ctx, jobRef, authClient, uid)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == DeletionStatusCompleted {
+		// Trabajos completados antes de que se eliminaran al terminar
+		if _, err := jobRef.Delete(ctx); err != nil {
+			return job, fmt.Errorf("error al eliminar el trabajo de eliminación: %v", err)
+		}
+		return job, nil
+	}
+
+	job.Status = DeletionStatusRunning
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	if _, err := jobRef.Set(ctx, job); err != nil {
+		return nil, fmt.Errorf("error al guardar el trabajo de eliminación: %v", err)
+	}
+
+	for _, step := range deletionSteps {
+		if job.Steps[step] {
+			continue
+		}
+
+		if err := runDeletionStep(ctx, firestoreClient, authClient, storageClient, job, step); err != nil {
+			job.Status = DeletionStatusFailed
+			job.LastError = fmt.Sprintf("%s: %v", step, err)
+			job.UpdatedAt = time.Now()
+			if _, saveErr := jobRef.Set(ctx, job); saveErr != nil {
+				log.Printf("Error al guardar el progreso de la eliminación de %s: %v", uid, saveErr)
+			}
+			return job, fmt.Errorf("error en el paso %s: %v", step, err)
+		}
+
+		job.Steps[step] = true
+		job.UpdatedAt = time.Now()
+		if _, err := jobRef.Set(ctx, job); err != nil {
+			return job, fmt.Errorf("error al guardar el progreso de la eliminación: %v", err)
+		}
+	}
+
+	// El trabajo terminado guarda el correo y el uid de la cuenta, así que no se conserva
+	now := time.Now()
+	job.Status = DeletionStatusCompleted
+	job.LastError = ""
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	if _, err := jobRef.Delete(ctx); err != nil {
+		return job, fmt.Errorf("error al eliminar el trabajo de eliminación: %v", err)
+	}
+
+	audit.Emit(audit.Event{Action: audit.ActionAccountDelete, SubjectUID: uid, Email: job.Email})
+	return job, nil
+}
+
+// loadOrCreateDeletionJob obtiene el trabajo de eliminación existente o crea uno nuevo con los datos de la cuenta.
+func loadOrCreateDeletionJob(ctx context.Context, jobRef *firestore.DocumentRef, authClient *auth.Client, uid string) (*AccountDeletionJob, error) {
+	doc, err := jobRef.Get(ctx)
+	if err == nil {
+		var job AccountDeletionJob
+		if err := doc.DataTo(&job); err != nil {
+			return nil, fmt.Errorf("error al leer el trabajo de eliminación: %v", err)
+		}
+		if job.Steps == nil {
+			job.Steps = map[string]bool{}
+		}
+		return &job, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("error al obtener el trabajo de eliminación: %v", err)
+	}
+
+	// El correo se guarda antes de eliminar nada para poder enviar la confirmación al final
+	user, err := authClient.GetUser(ctx, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el usuario: %v", err)
+	}
+
+	now := time.Now()
+	return &AccountDeletionJob{
+		UID:       uid,
+		Email:     user.Email,
+		Steps:     map[string]bool{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// runDeletionStep ejecuta un paso de la eliminación. Cada paso es idempotente para poder reintentarlo.
+func runDeletionStep(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client, job *AccountDeletionJob, step string) error {
+	userRef := firestoreClient.Collection("users").Doc(job.UID)
+
+	switch step {
+	case "storage":
+		return deleteAllFromCloudStorage(job.UID, storageClient)
+
+	case "exports":
+		return deleteFromCloudStorageByPrefix(fmt.Sprintf("exports/%s/", job.UID), storageClient)
+
+	case "password_resets":
+		if job.Email == "" {
+			return nil
+		}
+		_, err := firestoreClient.Collection("password_resets").Doc(job.Email).Delete(ctx)
+		return err
+
+	case "login_attempts":
+		if job.Email == "" {
+			return nil
+		}
+		// Unlock no depende de la configuración del Guard
+		return lockout.NewGuard(firestoreClient, lockout.Config{}).Unlock(ctx, job.Email)
+
+	case "approvals":
+		return approvals.NewQueue(firestoreClient, false, nil).Delete(ctx, job.UID)
+
+	case "api_keys":
+		return apikeys.NewStore(firestoreClient).DeleteAll(ctx, job.UID)
+
+	case "organizations":
+		// Las membresías también se guardan en organizations/{orgId}/members, fuera del documento del usuario
+		store := orgs.NewFirestoreStore(firestoreClient)
+		memberships, err := store.UserMemberships(ctx, job.UID)
+		if err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			if err := store.RemoveMember(ctx, membership.OrgID, job.UID); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "subcollections":
+		// Eliminar un documento en Firestore no elimina sus subcolecciones (p. ej. passkeys)
+		collections := userRef.Collections(ctx)
+		for {
+			collection, err := collections.Next()
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := deleteCollectionDocs(ctx, collection); err != nil {
+				return err
+			}
+		}
+
+	case "profile":
+		_, err := userRef.Delete(ctx)
+		return err
+
+	case "auth":
+		err := authClient.DeleteUser(ctx, job.UID)
+		if err != nil && !auth.IsUserNotFound(err) {
+			return err
+		}
+		return nil
+
+	case "email":
+		if job.Email == "" {
+			return nil
+		}
+		data := struct {
+			Email string
+			Year  int
+		}{
+			Email: job.Email,
+			Year:  time.Now().Year(),
+		}
+		return sendTemplateMail(accountDeletedT, job.Email, "Tu cuenta fue eliminada", data)
+	}
+
+	return fmt.Errorf("paso de eliminación desconocido: %s", step)
+}
+
+// deleteCollectionDocs elimina todos los documentos de una colección.
+func deleteCollectionDocs(ctx context.Context, collection *firestore.CollectionRef) error {
+	it := collection.Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// PurgeExpiredAccountDeletions elimina de forma permanente las cuentas cuyo plazo de restauración venció.
+func PurgeExpiredAccountDeletions(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	it := firestoreClient.Collection("account_deletions").
+		Where("status", "==", DeletionStatusScheduled).
+		Where("purgeAt", "<=", time.Now()).
+		Documents(ctx)
+	defer it.Stop()
+
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Printf("Error al obtener cuentas por eliminar: %v", err)
+			return
+		}
+
+		// Tomar el trabajo en una transacción para no competir con una restauración simultánea
+		claimed, err := claimScheduledDeletion(ctx, firestoreClient, doc.Ref)
+		if err != nil {
+			log.Printf("Error al tomar la eliminación de la cuenta %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		if _, err := runAccountDeletion(ctx, firestoreClient, authClient, storageClient, doc.Ref.ID); err != nil {
+			log.Printf("Error al eliminar la cuenta %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
+
+// claimScheduledDeletion pasa a "running" un trabajo programado cuyo plazo venció. Devuelve false si
+// el trabajo ya no está programado (por ejemplo, porque la cuenta fue restaurada).
+func claimScheduledDeletion(ctx context.Context, firestoreClient *firestore.Client, jobRef *firestore.DocumentRef) (bool, error) {
+	claimed := false
+	err := firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(jobRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var job AccountDeletionJob
+		if err := doc.DataTo(&job); err != nil {
+			return err
+		}
+		if job.Status != DeletionStatusScheduled || time.Now().Before(job.PurgeAt) {
+			return nil
+		}
+		claimed = true
+		return tx.Update(jobRef, []firestore.Update{
+			{Path: "status", Value: DeletionStatusRunning},
+			{Path: "updatedAt", Value: time.Now()},
+		})
+	})
+	return claimed, err
+}
+
+// ResumeFailedAccountDeletions retoma los trabajos de eliminación que quedaron incompletos y elimina los
+// completados que quedaron guardados.
+func ResumeFailedAccountDeletions(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	it := firestoreClient.Collection("account_deletions").
+		Where("status", "in", []string{DeletionStatusFailed, DeletionStatusRunning, DeletionStatusCompleted}).
+		Documents(ctx)
+	defer it.Stop()
+
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Printf("Error al obtener trabajos de eliminación pendientes: %v", err)
+			return
+		}
+
+		// Un trabajo en curso reciente puede estar siendo ejecutado por otra solicitud
+		var job AccountDeletionJob
+		if err := doc.DataTo(&job); err != nil {
+			log.Printf("Error al leer el trabajo de eliminación %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		if job.Status == DeletionStatusRunning && time.Since(job.UpdatedAt) < 10*time.Minute {
+			continue
+		}
+
+		if _, err := runAccountDeletion(ctx, firestoreClient, authClient, storageClient, doc.Ref.ID); err != nil {
+			log.Printf("Error al reintentar la eliminación de la cuenta %s: %v", doc.Ref.ID, err)
+		}
+	}
+}
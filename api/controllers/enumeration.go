@@ -0,0 +1,110 @@
+// backend/api/controllers/enumeration.go
+
+package controllers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/api/httputil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// ErrCodeInvalidCredentials indica credenciales incorrectas sin distinguir si la cuenta existe
+const ErrCodeInvalidCredentials = "invalid_credentials"
+
+// Protección contra enumeración de cuentas (ENUMERATION_PROTECTION). Cuando está activa, /login,
+// /register, /forgot-password y /verify-code responden lo mismo exista o no la cuenta, y los casos de
+// cuenta existente se resuelven por correo al dueño.
+var (
+	enumerationProtection bool
+	// enumerationMinResponse es la duración mínima de las respuestas protegidas, para que el tiempo de
+	// respuesta no delate si la cuenta existe (ENUMERATION_MIN_RESPONSE_TIME, por defecto 1s)
+	enumerationMinResponse = time.Second
+	accountExistsT         *template.Template
+	loginBlockedT          *template.Template
+)
+
+// enumerationJitter es la variación aleatoria que se suma a la duración mínima
+const enumerationJitter = 250 * time.Millisecond
+
+func init() {
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error cargando archivo .env: %v", err)
+	}
+	accountExistsT = template.Must(template.ParseFiles("html/account_exists.html"))
+	loginBlockedT = template.Must(template.ParseFiles("html/login_blocked.html"))
+
+	if value := strings.TrimSpace(os.Getenv("ENUMERATION_PROTECTION")); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("ENUMERATION_PROTECTION inválido: %q", value)
+		}
+		enumerationProtection = enabled
+	}
+	if value := strings.TrimSpace(os.Getenv("ENUMERATION_MIN_RESPONSE_TIME")); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			log.Fatalf("ENUMERATION_MIN_RESPONSE_TIME inválido: %q", value)
+		}
+		enumerationMinResponse = d
+	}
+}
+
+// padResponse espera hasta completar la duración mínima desde start, con una variación aleatoria, para
+// que las respuestas con y sin cuenta tarden lo mismo
+func padResponse(start time.Time) {
+	target := enumerationMinResponse + time.Duration(rand.Int63n(int64(enumerationJitter)))
+	if remaining := target - time.Since(start); remaining > 0 {
+		time.Sleep(remaining)
+	}
+}
+
+// respondInvalidCredentials responde un inicio de sesión fallido sin indicar si el correo existe
+func respondInvalidCredentials(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{
+		Message: "Correo o contraseña incorrectos",
+		Code:    ErrCodeInvalidCredentials,
+	})
+}
+
+// sendAccountExistsMail avisa al dueño de un correo que alguien intentó registrarse con él
+func sendAccountExistsMail(to string) error {
+	frontend := os.Getenv("URL_FRONTEND")
+	data := struct {
+		Email      string
+		LoginLink  string
+		ForgotLink string
+		Year       int
+	}{
+		Email:      to,
+		LoginLink:  fmt.Sprintf("%s/login", frontend),
+		ForgotLink: fmt.Sprintf("%s/forgot-password", frontend),
+		Year:       time.Now().Year(),
+	}
+	return sendTemplateMail(accountExistsT, to, "Intento de registro con tu correo", data)
+}
+
+// sendLoginBlockedMail avisa al dueño de la cuenta por qué no pudo iniciar sesión, cuando la respuesta de
+// /login no lo indica
+func sendLoginBlockedMail(to, reason string) error {
+	data := struct {
+		Email  string
+		Reason string
+		Year   int
+	}{
+		Email:  to,
+		Reason: reason,
+		Year:   time.Now().Year(),
+	}
+	return sendTemplateMail(loginBlockedT, to, "Intento de inicio de sesión en tu cuenta", data)
+}
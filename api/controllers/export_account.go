@@ -0,0 +1,383 @@
+// backend/api/controllers/export_account.go
+
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/httputil"
+	"backend/api/passwordhistory"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var dataExportReadyT *template.Template
+
+func init() {
+	// Cargar el template del correo con el enlace de descarga de la exportación
+	dataExportReadyT = template.Must(template.ParseFiles("html/data_export_ready.html"))
+}
+
+// defaultExportSyncMaxBytes es el tamaño estimado a partir del cual la exportación se genera en segundo plano
+const defaultExportSyncMaxBytes = 5 << 20
+
+// exportLinkValidity es la vigencia del enlace de descarga (el máximo que permite una URL firmada V4)
+const exportLinkValidity = 7 * 24 * time.Hour
+
+// ExportAccount exporta los datos personales del usuario autenticado.
+//
+// El archivo ZIP incluye el registro de Firebase Auth, el documento users/{uid} completo con sus
+// subcolecciones, las fotos de perfil, el historial de seguridad y los registros de consentimiento
+// (users/{uid}/consents). Si la exportación es grande, o se pide con ?async=true, se genera en segundo
+// plano y se envía por correo un enlace de descarga.
+//
+// @Summary Exportar datos personales
+// @Description Genera un ZIP con todos los datos personales del usuario autenticado.
+// @Tags account
+// @Produce application/zip
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param async query bool false "Generar la exportación en segundo plano y enviarla por correo"
+// @Success 200 {file} file "Archivo ZIP con los datos del usuario"
+// @Success 202 {object} httputil.StandardResponse "La exportación se enviará por correo"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /account/export [get]
+func ExportAccount(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	photosSize, err := cloudStoragePrefixSize(fmt.Sprintf("profile_photos/%s/", uid), storageClient)
+	if err != nil {
+		log.Printf("Error al calcular el tamaño de las fotos de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+		return
+	}
+
+	if c.Query("async") == "true" || photosSize > exportSyncMaxBytes() {
+		user, err := authClient.GetUser(context.Background(), uid)
+		if err != nil || user.Email == "" {
+			log.Printf("Error al obtener el correo del usuario %s: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+			return
+		}
+
+		go func() {
+			if err := exportAccountAsync(context.Background(), firestoreClient, authClient, storageClient, uid, user.Email); err != nil {
+				log.Printf("Error al generar la exportación en segundo plano de %s: %v", uid, err)
+			}
+		}()
+
+		audit.Record(c, audit.Event{Action: audit.ActionAccountExport, Details: map[string]interface{}{"async": true}})
+		c.JSON(http.StatusAccepted, httputil.StandardResponse{
+			Message: "La exportación se está generando. Recibirás un enlace de descarga por correo.",
+		})
+		return
+	}
+
+	// Generar el ZIP en un archivo temporal antes de responder para poder informar errores con un JSON
+	tempFile, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+		return
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if err := writeAccountExport(context.Background(), firestoreClient, authClient, storageClient, uid, tempFile); err != nil {
+		log.Printf("Error al generar la exportación de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+		return
+	}
+
+	info, err := tempFile.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+		return
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar la exportación"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAccountExport, Details: map[string]interface{}{"async": false}})
+	fileName := fmt.Sprintf("export-%s-%s.zip", uid, time.Now().Format("20060102"))
+	c.DataFromReader(http.StatusOK, info.Size(), "application/zip", tempFile, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, fileName),
+	})
+}
+
+// exportAccountAsync genera la exportación, la sube al bucket en exports/{uid}/ y envía el enlace por correo.
+func exportAccountAsync(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client, uid, email string) error {
+	bucketName := os.Getenv("GCS_BUCKET_NAME")
+	if bucketName == "" {
+		return fmt.Errorf("GCS_BUCKET_NAME no está configurado en las variables de entorno")
+	}
+
+	objName := fmt.Sprintf("exports/%s/%s.zip", uid, uuid.New().String())
+	wc := storageClient.Bucket(bucketName).Object(objName).NewWriter(ctx)
+	wc.ContentType = "application/zip"
+
+	if err := writeAccountExport(ctx, firestoreClient, authClient, storageClient, uid, wc); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("error al cerrar escritor de Cloud Storage: %v", err)
+	}
+
+	expiresAt := time.Now().Add(exportLinkValidity)
+	downloadLink, err := storageClient.Bucket(bucketName).SignedURL(objName, &storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: expiresAt,
+		Scheme:  storage.SigningSchemeV4,
+	})
+	if err != nil {
+		return fmt.Errorf("error al firmar el enlace de descarga: %v", err)
+	}
+
+	data := struct {
+		DownloadLink string
+		ExpiresAt    string
+		Year         int
+	}{
+		DownloadLink: downloadLink,
+		ExpiresAt:    expiresAt.Format("02-01-2006 15:04"),
+		Year:         time.Now().Year(),
+	}
+	return sendTemplateMail(dataExportReadyT, email, "Tu exportación de datos está lista", data)
+}
+
+// writeAccountExport escribe en w el ZIP con todos los datos personales del usuario.
+func writeAccountExport(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client, uid string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	user, err := authClient.GetUser(ctx, uid)
+	if err != nil {
+		return fmt.Errorf("error al obtener el usuario de Firebase Auth: %v", err)
+	}
+
+	// Registro de Firebase Auth
+	authRecord, err := GetUserInfo(authClient, uid)
+	if err != nil {
+		return fmt.Errorf("error al obtener la información del usuario: %v", err)
+	}
+	authRecord["disabled"] = user.Disabled
+	authRecord["customClaims"] = user.CustomClaims
+	authRecord["providers"] = user.ProviderUserInfo
+	if err := writeZipJSON(zw, "auth.json", authRecord); err != nil {
+		return err
+	}
+
+	// Documento users/{uid} completo y sus subcolecciones
+	userRef := firestoreClient.Collection("users").Doc(uid)
+	profile := map[string]interface{}{}
+	if doc, err := userRef.Get(ctx); err == nil {
+		profile = doc.Data()
+	} else if status.Code(err) != codes.NotFound {
+		return fmt.Errorf("error al obtener el perfil: %v", err)
+	}
+	// Los hashes de contraseñas anteriores no son datos personales útiles y no deben salir del servidor
+	delete(profile, passwordhistory.FieldHistory)
+	if err := writeZipJSON(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	subcollections := userRef.Collections(ctx)
+	for {
+		collection, err := subcollections.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error al obtener las subcolecciones del perfil: %v", err)
+		}
+
+		docs, err := collectionData(ctx, collection.Query)
+		if err != nil {
+			return err
+		}
+
+		// Los consentimientos se exportan aparte para que sean fáciles de encontrar
+		name := path.Join("profile", collection.ID+".json")
+		if collection.ID == "consents" {
+			name = "consents.json"
+		}
+		if err := writeZipJSON(zw, name, docs); err != nil {
+			return err
+		}
+	}
+
+	// Historial de seguridad
+	history, err := securityHistory(ctx, firestoreClient, user)
+	if err != nil {
+		return err
+	}
+	if err := writeZipJSON(zw, "security_history.json", history); err != nil {
+		return err
+	}
+
+	// Fotos de perfil
+	if err := writeZipPhotos(ctx, zw, storageClient, uid); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// securityHistory reúne la actividad de seguridad conocida de la cuenta.
+func securityHistory(ctx context.Context, firestoreClient *firestore.Client, user *auth.UserRecord) (map[string]interface{}, error) {
+	history := map[string]interface{}{}
+
+	if user.UserMetadata != nil {
+		history["createdAt"] = time.UnixMilli(user.UserMetadata.CreationTimestamp)
+		if user.UserMetadata.LastLogInTimestamp > 0 {
+			history["lastLoginAt"] = time.UnixMilli(user.UserMetadata.LastLogInTimestamp)
+		}
+		if user.UserMetadata.LastRefreshTimestamp > 0 {
+			history["lastRefreshAt"] = time.UnixMilli(user.UserMetadata.LastRefreshTimestamp)
+		}
+	}
+	if user.TokensValidAfterMillis > 0 {
+		history["sessionsRevokedAt"] = time.UnixMilli(user.TokensValidAfterMillis)
+	}
+
+	if user.Email != "" {
+		doc, err := firestoreClient.Collection("password_resets").Doc(user.Email).Get(ctx)
+		if err == nil {
+			reset := doc.Data()
+			delete(reset, "resetToken")
+			history["passwordReset"] = reset
+		} else if status.Code(err) != codes.NotFound {
+			return nil, fmt.Errorf("error al obtener las solicitudes de restablecimiento: %v", err)
+		}
+	}
+
+	// Eventos de auditoría en los que el usuario es el afectado, si el registro se puede consultar
+	if querier, ok := audit.Default().Querier(); ok {
+		events, err := querier.Query(ctx, audit.Filter{SubjectUID: user.UID})
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener los eventos de auditoría: %v", err)
+		}
+		history["auditEvents"] = events
+	}
+
+	return history, nil
+}
+
+// writeZipPhotos copia al ZIP las fotos de perfil del usuario.
+func writeZipPhotos(ctx context.Context, zw *zip.Writer, storageClient *storage.Client, uid string) error {
+	bucketName := os.Getenv("GCS_BUCKET_NAME")
+	if bucketName == "" {
+		return fmt.Errorf("GCS_BUCKET_NAME no está configurado en las variables de entorno")
+	}
+
+	bucket := storageClient.Bucket(bucketName)
+	it := bucket.Objects(ctx, &storage.Query{Prefix: fmt.Sprintf("profile_photos/%s/", uid)})
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error al obtener objetos en Cloud Storage: %v", err)
+		}
+
+		rc, err := bucket.Object(objAttrs.Name).NewReader(ctx)
+		if err != nil {
+			return fmt.Errorf("error al leer %s de Cloud Storage: %v", objAttrs.Name, err)
+		}
+		fw, err := zw.Create(path.Join("photos", path.Base(objAttrs.Name)))
+		if err == nil {
+			_, err = io.Copy(fw, rc)
+		}
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("error al copiar %s a la exportación: %v", objAttrs.Name, err)
+		}
+	}
+}
+
+// writeZipJSON agrega al ZIP un archivo JSON con el valor dado.
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("error al crear %s en la exportación: %v", name, err)
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("error al escribir %s en la exportación: %v", name, err)
+	}
+	return nil
+}
+
+// collectionData devuelve los datos de todos los documentos de la consulta, indexados por ID.
+func collectionData(ctx context.Context, query firestore.Query) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	it := query.Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return data, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener documentos: %v", err)
+		}
+		data[doc.Ref.ID] = doc.Data()
+	}
+}
+
+// cloudStoragePrefixSize suma el tamaño de los objetos del bucket con el prefijo dado.
+func cloudStoragePrefixSize(prefix string, client *storage.Client) (int64, error) {
+	bucketName := os.Getenv("GCS_BUCKET_NAME")
+	if bucketName == "" {
+		return 0, fmt.Errorf("GCS_BUCKET_NAME no está configurado en las variables de entorno")
+	}
+
+	var size int64
+	it := client.Bucket(bucketName).Objects(context.Background(), &storage.Query{Prefix: prefix})
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			return size, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error al obtener objetos en Cloud Storage: %v", err)
+		}
+		size += objAttrs.Size
+	}
+}
+
+// exportSyncMaxBytes devuelve el límite configurado en EXPORT_SYNC_MAX_BYTES o el valor por defecto.
+func exportSyncMaxBytes() int64 {
+	if value, err := strconv.ParseInt(os.Getenv("EXPORT_SYNC_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return defaultExportSyncMaxBytes
+}
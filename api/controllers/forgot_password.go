@@ -1,13 +1,12 @@
 package controllers
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
-	"text/template"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -15,7 +14,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
-	"backend/api/email"
+	"backend/api/audit"
 	"backend/api/httputil"
 	"backend/api/utils"
 )
@@ -47,7 +46,7 @@ type ForgotPasswordRequest struct {
 // @Param body body ForgotPasswordRequest true "Correo electrónico del usuario"
 // @Success 200 {object} httputil.StandardResponse "Correo de restablecimiento de contraseña enviado"
 // @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
-// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado (sin protección contra enumeración)"
 // @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
 // @Router /forgot-password [post]
 func ForgotPassword(c *gin.Context, authClient *auth.Client, firestoreClient *firestore.Client) {
@@ -57,72 +56,78 @@ func ForgotPassword(c *gin.Context, authClient *auth.Client, firestoreClient *fi
 		return
 	}
 
+	if enumerationProtection {
+		forgotPasswordUniformly(c, authClient, firestoreClient, req.Email)
+		return
+	}
+
 	user, err := authClient.GetUserByEmail(context.Background(), req.Email)
 	if err != nil {
 		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
 		return
 	}
 
+	if err := sendPasswordReset(firestoreClient, user.UID, req.Email); err != nil {
+		log.Printf("Error al enviar el restablecimiento de contraseña a %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de restablecimiento"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionPasswordResetRequest, SubjectUID: user.UID, Email: req.Email})
+	// Enviar respuesta de éxito
+	response := httputil.StandardResponse{
+		Message: "Se ha enviado un correo electrónico con instrucciones para restablecer la contraseña.",
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// forgotPasswordUniformly responde con la protección contra enumeración: el mismo mensaje y la misma
+// duración exista o no la cuenta. El correo se envía en segundo plano solo si la cuenta existe.
+func forgotPasswordUniformly(c *gin.Context, authClient *auth.Client, firestoreClient *firestore.Client, email string) {
+	start := time.Now()
+	if user, err := authClient.GetUserByEmail(context.Background(), email); err == nil {
+		go func() {
+			if err := sendPasswordReset(firestoreClient, user.UID, email); err != nil {
+				log.Printf("Error al enviar el restablecimiento de contraseña a %s: %v", email, err)
+			}
+		}()
+		audit.Record(c, audit.Event{Action: audit.ActionPasswordResetRequest, SubjectUID: user.UID, Email: email})
+	}
+
+	padResponse(start)
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Si existe una cuenta con ese correo, recibirás instrucciones para restablecer la contraseña.",
+	})
+}
+
+// sendPasswordReset genera el token de restablecimiento, lo guarda en password_resets y envía el enlace al correo indicado.
+func sendPasswordReset(firestoreClient *firestore.Client, uid, to string) error {
 	// Generar token JWT
-	token, err := utils.GenerarToken(req.Email, user.UID)
+	token, err := utils.GenerarToken(to, uid)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar token de restablecimiento"})
-		return
+		return fmt.Errorf("error al generar token de restablecimiento: %v", err)
 	}
 
 	// Guardar token en Firestore con una expiración
 	resetData := map[string]interface{}{
-		"email":      req.Email,
+		"email":      to,
 		"resetToken": token,
-		"expiresAt":  time.Now().Add(30 * time.Minute), // Establecer expiración del token si es necesario
+		"expiresAt":  time.Now().Add(30 * time.Minute),
 	}
-	_, err = firestoreClient.Collection("password_resets").Doc(req.Email).Set(context.Background(), resetData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al guardar token de restablecimiento"})
-		return
+	if _, err := firestoreClient.Collection("password_resets").Doc(to).Set(context.Background(), resetData); err != nil {
+		return fmt.Errorf("error al guardar token de restablecimiento: %v", err)
 	}
 
-	// Construir el enlace de restablecimiento de contraseña
-	urlFrontend := os.Getenv("URL_FRONTEND")
-	resetLink := fmt.Sprintf("%s/reset-password?token=%s", urlFrontend, token)
-	subject := "Restablecimiento de contraseña"
-
 	// Datos para el template HTML del correo
 	data := struct {
 		ResetLink string
 		Email     string
 		Year      int
 	}{
-		ResetLink: resetLink,
-		Email:     req.Email,
+		ResetLink: fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("URL_FRONTEND"), token),
+		Email:     to,
 		Year:      time.Now().Year(),
 	}
 
-	var mailBody bytes.Buffer
-	if err := resetPasswordT.Execute(&mailBody, data); err != nil {
-		log.Printf("Error al ejecutar el template HTML: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de restablecimiento"})
-		return
-	}
-
-	// Configurar y enviar el correo de restablecimiento
-	smtpConfig := email.SmtpConfig{
-		Host:     os.Getenv("SMTP_HOST"),
-		Port:     os.Getenv("SMTP_PORT"),
-		Username: os.Getenv("SMTP_USERNAME"),
-		Password: os.Getenv("SMTP_PASSWORD"),
-	}
-
-	err = email.SendMail(smtpConfig, req.Email, subject, mailBody.String())
-	if err != nil {
-		log.Printf("Error al enviar el correo de restablecimiento: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de restablecimiento"})
-		return
-	}
-
-	// Enviar respuesta de éxito
-	response := httputil.StandardResponse{
-		Message: "Se ha enviado un correo electrónico con instrucciones para restablecer la contraseña.",
-	}
-	c.JSON(http.StatusOK, response)
+	return sendTemplateMail(resetPasswordT, to, "Restablecimiento de contraseña", data)
 }
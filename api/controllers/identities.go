@@ -0,0 +1,398 @@
+// backend/api/controllers/identities.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/httputil"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// Tipos de identidad de una cuenta. Las passkeys ya no se pueden vincular, porque el backend no verifica
+// la ceremonia WebAuthn ni permite iniciar sesión con ellas; las que se guardaron antes se listan y se
+// pueden desvincular.
+const (
+	IdentityTypePassword = "password"
+	IdentityTypeOIDC     = "oidc"
+	IdentityTypePasskey  = "passkey"
+)
+
+// Identity representa una credencial de inicio de sesión vinculada a la cuenta
+type Identity struct {
+	Type       string     `json:"type"`
+	ProviderID string     `json:"providerId"`
+	Identifier string     `json:"identifier"`
+	Name       string     `json:"name,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+}
+
+// LinkIdentityRequest representa los datos para vincular una nueva identidad.
+//
+// Según el tipo se usan distintos campos:
+//   - password: password
+//   - oidc: providerId (p. ej. "oidc.utem" o "google.com") y providerToken (ID token del proveedor)
+type LinkIdentityRequest struct {
+	Type          string `json:"type" binding:"required"`
+	Password      string `json:"password"`
+	ProviderID    string `json:"providerId"`
+	ProviderToken string `json:"providerToken"`
+}
+
+// passkeyData representa una passkey almacenada en users/{uid}/passkeys
+type passkeyData struct {
+	CredentialID string    `firestore:"credentialId"`
+	PublicKey    string    `firestore:"publicKey"`
+	Name         string    `firestore:"name"`
+	CreatedAt    time.Time `firestore:"createdAt"`
+}
+
+// ListIdentities lista las identidades vinculadas a la cuenta autenticada.
+//
+// @Summary Listar identidades
+// @Description Lista las credenciales (contraseña, proveedores OIDC y passkeys) vinculadas a la cuenta autenticada.
+// @Tags identities
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Identidades de la cuenta"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /identities [get]
+func ListIdentities(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	identities, err := getIdentities(firestoreClient, authClient, uid)
+	if err != nil {
+		log.Printf("Error al obtener identidades del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener las identidades"})
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Identidades obtenidas correctamente",
+		Data:    identities,
+	})
+}
+
+// LinkIdentity vincula una nueva identidad a la cuenta autenticada.
+//
+// Al vincular un proveedor externo se usa el ID token actual del usuario, de modo que la
+// identidad queda asociada al mismo uid en lugar de crear una cuenta nueva.
+//
+// @Summary Vincular identidad
+// @Description Vincula una contraseña o un proveedor OIDC a la cuenta autenticada.
+// @Tags identities
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body LinkIdentityRequest true "Identidad a vincular"
+// @Success 200 {object} httputil.StandardResponse "Identidad vinculada"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 409 {object} httputil.ErrorResponse "La identidad ya está vinculada"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /identities/link [post]
+func LinkIdentity(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store) {
+	var req LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al obtener usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener información del usuario"})
+		return
+	}
+
+	var data map[string]interface{}
+
+	switch req.Type {
+	case IdentityTypePassword:
+		if req.Password == "" {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Se requiere una contraseña"})
+			return
+		}
+		if user.Email == "" {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "La cuenta no tiene un correo electrónico asociado"})
+			return
+		}
+		if hasProvider(user, IdentityTypePassword) {
+			c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La cuenta ya tiene una contraseña"})
+			return
+		}
+		if !checkPasswordPolicy(c, passwordPolicy, "password", req.Password, user.Email, user.DisplayName) {
+			return
+		}
+		if _, err := authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).Password(req.Password)); err != nil {
+			log.Printf("Error al vincular contraseña al usuario %s: %v", uid, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al vincular la contraseña"})
+			return
+		}
+		recordPassword(passwordHistory, uid, req.Password)
+
+	case IdentityTypeOIDC:
+		if req.ProviderID == "" || req.ProviderToken == "" {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Se requieren providerId y providerToken"})
+			return
+		}
+		idToken := c.GetString("idToken")
+		result, err := identityToolkitPost("signInWithIdp", map[string]interface{}{
+			"idToken":             idToken,
+			"postBody":            url.Values{"id_token": {req.ProviderToken}, "providerId": {req.ProviderID}}.Encode(),
+			"requestUri":          identityRequestURI(),
+			"returnSecureToken":   true,
+			"returnIdpCredential": true,
+		})
+		if err != nil {
+			var itErr *identityToolkitError
+			if errors.As(err, &itErr) {
+				switch {
+				case strings.HasPrefix(itErr.Message, "FEDERATED_USER_ID_ALREADY_LINKED"), strings.HasPrefix(itErr.Message, "EMAIL_EXISTS"):
+					c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La identidad ya está vinculada a otra cuenta"})
+				default:
+					c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: itErr.Message})
+				}
+				return
+			}
+			log.Printf("Error al vincular proveedor %s al usuario %s: %v", req.ProviderID, uid, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al comunicarse con Firebase"})
+			return
+		}
+		// Firebase puede devolver una cuenta distinta si el proveedor ya tenía una; en ese caso no se vincula
+		if localID, _ := result["localId"].(string); localID != "" && localID != uid {
+			c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La identidad ya está vinculada a otra cuenta"})
+			return
+		}
+		// El token del usuario cambia al vincular un proveedor, así que se devuelve el nuevo
+		if newToken, ok := result["idToken"].(string); ok {
+			data = map[string]interface{}{"token": newToken}
+		}
+
+	default:
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Tipo de identidad no soportado"})
+		return
+	}
+
+	if err := syncProfileProviders(firestoreClient, authClient, uid); err != nil {
+		log.Printf("Advertencia: no se pudo sincronizar el perfil del usuario %s: %v", uid, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionIdentityLink, Details: map[string]interface{}{"type": req.Type}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Identidad vinculada correctamente",
+		Data:    data,
+	})
+}
+
+// UnlinkIdentity desvincula una identidad de la cuenta autenticada.
+//
+// No se permite desvincular la última credencial de la cuenta, ya que el usuario
+// quedaría sin forma de iniciar sesión. Las passkeys no cuentan para esta regla.
+//
+// @Summary Desvincular identidad
+// @Description Desvincula una contraseña, un proveedor OIDC o una passkey de la cuenta autenticada.
+// @Tags identities
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param provider path string true "password, el providerId del proveedor OIDC o passkey"
+// @Param credentialId query string false "ID de la passkey (solo para provider=passkey)"
+// @Success 200 {object} httputil.StandardResponse "Identidad desvinculada"
+// @Failure 400 {object} httputil.ErrorResponse "No se puede desvincular la última credencial"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 404 {object} httputil.ErrorResponse "Identidad no encontrada"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /identities/{provider} [delete]
+func UnlinkIdentity(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+	provider := c.Param("provider")
+
+	identities, err := getIdentities(firestoreClient, authClient, uid)
+	if err != nil {
+		log.Printf("Error al obtener identidades del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener las identidades"})
+		return
+	}
+
+	credentialID := c.Query("credentialId")
+	found := false
+	for _, identity := range identities {
+		if provider == IdentityTypePasskey {
+			found = identity.Type == IdentityTypePasskey && identity.Identifier == credentialID
+		} else {
+			found = identity.Type != IdentityTypePasskey && identity.ProviderID == provider
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Identidad no encontrada"})
+		return
+	}
+
+	// Las passkeys no cuentan como credencial: no permiten iniciar sesión, así que no pueden reemplazar a
+	// la contraseña ni a un proveedor OIDC
+	if provider != IdentityTypePasskey {
+		signInIdentities := 0
+		for _, identity := range identities {
+			if identity.Type != IdentityTypePasskey {
+				signInIdentities++
+			}
+		}
+		if signInIdentities <= 1 {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "No se puede desvincular la última credencial de la cuenta"})
+			return
+		}
+	}
+
+	if provider == IdentityTypePasskey {
+		_, err = firestoreClient.Collection("users").Doc(uid).Collection("passkeys").Doc(credentialID).Delete(context.Background())
+	} else {
+		_, err = identityToolkitPost("update", map[string]interface{}{
+			"idToken":        c.GetString("idToken"),
+			"deleteProvider": []string{provider},
+		})
+	}
+	if err != nil {
+		log.Printf("Error al desvincular %s del usuario %s: %v", provider, uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al desvincular la identidad"})
+		return
+	}
+
+	if err := syncProfileProviders(firestoreClient, authClient, uid); err != nil {
+		log.Printf("Advertencia: no se pudo sincronizar el perfil del usuario %s: %v", uid, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionIdentityUnlink, Details: map[string]interface{}{"provider": provider}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Identidad desvinculada correctamente"})
+}
+
+// getIdentities combina los proveedores de Firebase Auth con las passkeys guardadas en Firestore.
+func getIdentities(firestoreClient *firestore.Client, authClient *auth.Client, uid string) ([]Identity, error) {
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		return nil, err
+	}
+
+	identities := []Identity{}
+	for _, info := range user.ProviderUserInfo {
+		identityType := IdentityTypeOIDC
+		if info.ProviderID == IdentityTypePassword {
+			identityType = IdentityTypePassword
+		}
+		identifier := info.Email
+		if identifier == "" {
+			identifier = info.UID
+		}
+		identities = append(identities, Identity{
+			Type:       identityType,
+			ProviderID: info.ProviderID,
+			Identifier: identifier,
+			Name:       info.DisplayName,
+		})
+	}
+
+	it := firestoreClient.Collection("users").Doc(uid).Collection("passkeys").Documents(context.Background())
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error al obtener passkeys: %v", err)
+		}
+
+		var passkey passkeyData
+		if err := doc.DataTo(&passkey); err != nil {
+			return nil, fmt.Errorf("error al leer passkey %s: %v", doc.Ref.ID, err)
+		}
+		createdAt := passkey.CreatedAt
+		identities = append(identities, Identity{
+			Type:       IdentityTypePasskey,
+			ProviderID: IdentityTypePasskey,
+			Identifier: passkey.CredentialID,
+			Name:       passkey.Name,
+			CreatedAt:  &createdAt,
+		})
+	}
+
+	return identities, nil
+}
+
+// syncProfileProviders mantiene en users/{uid} la lista de identidades vinculadas, de modo que
+// ese documento siga siendo el único perfil del usuario sin importar cómo inicie sesión.
+func syncProfileProviders(firestoreClient *firestore.Client, authClient *auth.Client, uid string) error {
+	identities, err := getIdentities(firestoreClient, authClient, uid)
+	if err != nil {
+		return err
+	}
+
+	providers := []string{}
+	for _, identity := range identities {
+		providers = append(providers, identity.ProviderID)
+	}
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		return err
+	}
+
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), map[string]interface{}{
+		"email":     user.Email,
+		"providers": providers,
+	}, firestore.MergeAll)
+	return err
+}
+
+// hasProvider indica si el usuario tiene vinculado el proveedor indicado en Firebase Auth.
+func hasProvider(user *auth.UserRecord, providerID string) bool {
+	for _, info := range user.ProviderUserInfo {
+		if info.ProviderID == providerID {
+			return true
+		}
+	}
+	return false
+}
+
+// identityRequestURI devuelve la URI de continuación que exige signInWithIdp.
+func identityRequestURI() string {
+	if urlFrontend := os.Getenv("URL_FRONTEND"); urlFrontend != "" {
+		return urlFrontend
+	}
+	return "http://localhost"
+}
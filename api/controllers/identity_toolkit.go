@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// identityToolkitError representa un error devuelto por la API REST de Identity Toolkit (por ejemplo EMAIL_EXISTS).
+type identityToolkitError struct {
+	Message string
+}
+
+func (e *identityToolkitError) Error() string {
+	return e.Message
+}
+
+// identityToolkitPost realiza una solicitud POST a la API REST de Identity Toolkit y devuelve la respuesta decodificada.
+//
+// Si Firebase responde con un error, se devuelve un *identityToolkitError con el código recibido.
+func identityToolkitPost(method string, payload interface{}) (map[string]interface{}, error) {
+	requestBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error al serializar la solicitud: %v", err)
+	}
+
+	firebaseAPIURL := "https://identitytoolkit.googleapis.com/v1/accounts:" + method + "?key=" + firebaseAPIKey
+
+	resp, err := http.Post(firebaseAPIURL, "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error al realizar la solicitud a Firebase: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error al decodificar la respuesta de Firebase: %v", err)
+	}
+
+	if errMsg, ok := result["error"].(map[string]interface{}); ok {
+		message, _ := errMsg["message"].(string)
+		return result, &identityToolkitError{Message: message}
+	}
+
+	return result, nil
+}
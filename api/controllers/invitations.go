@@ -0,0 +1,556 @@
+// backend/api/controllers/invitations.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/claims"
+	"backend/api/httputil"
+	"backend/api/orgs"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
+	"backend/api/utils"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// invitationTTL es la vigencia de una invitación
+const invitationTTL = 7 * 24 * time.Hour
+
+// ErrCodeAccountExists indica que el correo invitado ya tiene una cuenta y debe aceptar la invitación con sesión iniciada
+const ErrCodeAccountExists = "account_exists"
+
+// Estados de una invitación. "expired" no se guarda: se calcula al listar.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+var invitationT *template.Template
+
+func init() {
+	invitationT = template.Must(template.ParseFiles("html/invitation_email.html"))
+}
+
+// errInvitationNotPending indica que la invitación ya fue aceptada o revocada
+var errInvitationNotPending = errors.New("la invitación ya no está pendiente")
+
+// Invitation representa una invitación guardada en invitations/{id}
+type Invitation struct {
+	ID         string     `json:"id" firestore:"-"`
+	Email      string     `json:"email" firestore:"email"`
+	Role       string     `json:"role,omitempty" firestore:"role,omitempty"`
+	OrgID      string     `json:"orgId,omitempty" firestore:"orgId,omitempty"`
+	OrgRole    string     `json:"orgRole,omitempty" firestore:"orgRole,omitempty"`
+	Status     string     `json:"status" firestore:"status"`
+	InvitedBy  string     `json:"invitedBy" firestore:"invitedBy"`
+	CreatedAt  time.Time  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" firestore:"expiresAt"`
+	AcceptedBy string     `json:"acceptedBy,omitempty" firestore:"acceptedBy,omitempty"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty" firestore:"acceptedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" firestore:"revokedAt,omitempty"`
+}
+
+// CreateInvitationRequest representa la solicitud para invitar a una persona
+type CreateInvitationRequest struct {
+	Email   string `json:"email" binding:"required"`
+	Role    string `json:"role"`
+	OrgID   string `json:"orgId"`
+	OrgRole string `json:"orgRole"`
+}
+
+// AcceptInvitationRequest representa la aceptación de una invitación. Password solo se usa si se crea una cuenta nueva.
+type AcceptInvitationRequest struct {
+	Token       string `json:"token" binding:"required"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName"`
+}
+
+// AdminCreateInvitation invita a una persona por correo, con un rol de la plataforma y/o de una organización.
+//
+// @Summary Crear invitación
+// @Description Envía por correo una invitación firmada que vence en 7 días, con el rol y la organización indicados.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body CreateInvitationRequest true "Datos de la invitación"
+// @Success 201 {object} httputil.StandardResponse "Invitación enviada"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Organización no encontrada"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/invitations [post]
+func AdminCreateInvitation(c *gin.Context, firestoreClient *firestore.Client, store orgs.Store) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Correo electrónico inválido"})
+		return
+	}
+	if req.Role != "" && !authz.Roles().Valid(req.Role) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Rol inválido"})
+		return
+	}
+
+	var orgName string
+	if req.OrgID != "" {
+		if req.OrgRole == "" {
+			req.OrgRole = orgs.RoleMember
+		}
+		if !orgs.Roles.Valid(req.OrgRole) {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Rol de organización inválido"})
+			return
+		}
+		org, err := store.Get(context.Background(), req.OrgID)
+		if err != nil {
+			respondOrgError(c, err)
+			return
+		}
+		orgName = org.Name
+	} else {
+		req.OrgRole = ""
+	}
+
+	now := time.Now()
+	docRef := firestoreClient.Collection("invitations").NewDoc()
+	invitation := Invitation{
+		ID:        docRef.ID,
+		Email:     email,
+		Role:      req.Role,
+		OrgID:     req.OrgID,
+		OrgRole:   req.OrgRole,
+		Status:    InvitationPending,
+		InvitedBy: c.MustGet("user").(*auth.Token).UID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationTTL),
+	}
+	if _, err := docRef.Create(context.Background(), invitation); err != nil {
+		log.Printf("Error al guardar la invitación para %s: %v", email, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	if err := sendInvitationMail(invitation, orgName); err != nil {
+		log.Printf("Error al enviar la invitación a %s: %v", email, err)
+		if _, delErr := docRef.Delete(context.Background()); delErr != nil {
+			log.Printf("Error al eliminar la invitación %s: %v", docRef.ID, delErr)
+		}
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar la invitación"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:  audit.ActionInvitationCreate,
+		Email:   email,
+		Details: map[string]interface{}{"invitationId": invitation.ID, "role": invitation.Role, "orgId": invitation.OrgID, "orgRole": invitation.OrgRole},
+	})
+	c.JSON(http.StatusCreated, httputil.StandardResponse{Message: "Invitación enviada correctamente", Data: invitation})
+}
+
+// AdminListInvitations lista las invitaciones, por defecto las pendientes.
+//
+// @Summary Listar invitaciones
+// @Description Lista las invitaciones con el estado indicado (pending, accepted, revoked o expired), de la más reciente a la más antigua.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param status query string false "Estado de las invitaciones (pending por defecto)"
+// @Success 200 {object} httputil.StandardResponse "Invitaciones"
+// @Failure 400 {object} httputil.ErrorResponse "Estado inválido"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/invitations [get]
+func AdminListInvitations(c *gin.Context, firestoreClient *firestore.Client) {
+	wanted := c.DefaultQuery("status", InvitationPending)
+
+	// Las invitaciones vencidas siguen guardadas como pendientes
+	stored := wanted
+	switch wanted {
+	case InvitationExpired:
+		stored = InvitationPending
+	case InvitationPending, InvitationAccepted, InvitationRevoked:
+	default:
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Estado inválido"})
+		return
+	}
+
+	now := time.Now()
+	invitations := []Invitation{}
+	it := firestoreClient.Collection("invitations").Where("status", "==", stored).Documents(context.Background())
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error al listar las invitaciones: %v", err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+			return
+		}
+
+		var invitation Invitation
+		if err := doc.DataTo(&invitation); err != nil {
+			log.Printf("Error al leer la invitación %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		invitation.ID = doc.Ref.ID
+
+		if invitation.Status == InvitationPending && invitation.ExpiresAt.Before(now) {
+			invitation.Status = InvitationExpired
+		}
+		if invitation.Status == wanted {
+			invitations = append(invitations, invitation)
+		}
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].CreatedAt.After(invitations[j].CreatedAt)
+	})
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Invitaciones obtenidas correctamente", Data: invitations})
+}
+
+// AdminRevokeInvitation revoca una invitación pendiente.
+//
+// @Summary Revocar invitación
+// @Description Revoca una invitación pendiente para que su enlace deje de funcionar.
+// @Tags admin
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param id path string true "ID de la invitación"
+// @Success 200 {object} httputil.StandardResponse "Invitación revocada"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Invitación no encontrada"
+// @Failure 409 {object} httputil.ErrorResponse "La invitación ya no está pendiente"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /admin/invitations/{id} [delete]
+func AdminRevokeInvitation(c *gin.Context, firestoreClient *firestore.Client) {
+	id := c.Param("id")
+	docRef := firestoreClient.Collection("invitations").Doc(id)
+
+	err := firestoreClient.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		if status, _ := doc.Data()["status"].(string); status != InvitationPending {
+			return errInvitationNotPending
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "status", Value: InvitationRevoked},
+			{Path: "revokedAt", Value: time.Now()},
+		})
+	})
+	if err != nil {
+		respondInvitationError(c, id, err)
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionInvitationRevoke, Details: map[string]interface{}{"invitationId": id}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Invitación revocada correctamente"})
+}
+
+// AcceptInvitation acepta una invitación.
+//
+// Si la solicitud incluye un token de sesión, la invitación se vincula a esa cuenta, cuyo correo debe ser
+// el invitado. Si no, se crea una cuenta nueva con la contraseña indicada. En ambos casos el correo queda
+// verificado, ya que el enlace de la invitación llegó a esa dirección, y se asignan el rol y la
+// organización de la invitación. Un rol existente solo se reemplaza si el invitado es superior.
+//
+// @Summary Aceptar invitación
+// @Description Acepta una invitación vinculándola a la cuenta con sesión iniciada o registrando una cuenta nueva ya verificada.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string false "Token de autorización JWT, para aceptar con una cuenta existente"
+// @Param body body AcceptInvitationRequest true "Token de la invitación y datos de la cuenta nueva"
+// @Success 200 {object} httputil.StandardResponse "Invitación aceptada"
+// @Failure 400 {object} httputil.ErrorResponse "Invitación inválida o expirada, o contraseña inválida"
+// @Failure 403 {object} httputil.ErrorResponse "La invitación fue enviada a otro correo"
+// @Failure 404 {object} httputil.ErrorResponse "Invitación no encontrada"
+// @Failure 409 {object} httputil.ErrorResponse "La invitación ya no está pendiente o el correo ya tiene una cuenta"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /invitations/accept [post]
+func AcceptInvitation(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, store orgs.Store, claimsManager *claims.Manager, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	tokenClaims, err := utils.VerificarTokenConProposito(req.Token, utils.PurposeInvitation)
+	if err != nil || tokenClaims.Id == "" {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Invitación inválida o expirada"})
+		return
+	}
+
+	ctx := context.Background()
+	docRef := firestoreClient.Collection("invitations").Doc(tokenClaims.Id)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		respondInvitationError(c, tokenClaims.Id, err)
+		return
+	}
+	var invitation Invitation
+	if err := doc.DataTo(&invitation); err != nil {
+		log.Printf("Error al leer la invitación %s: %v", doc.Ref.ID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+	invitation.ID = doc.Ref.ID
+
+	if invitation.Status != InvitationPending {
+		respondInvitationError(c, invitation.ID, errInvitationNotPending)
+		return
+	}
+	if invitation.ExpiresAt.Before(time.Now()) || !strings.EqualFold(invitation.Email, tokenClaims.Email) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Invitación inválida o expirada"})
+		return
+	}
+
+	// Con sesión iniciada, la cuenta debe ser la del correo invitado
+	var uid string
+	if token, ok := c.Get("user"); ok {
+		authTok := token.(*auth.Token)
+		if email, _ := authTok.Claims["email"].(string); !strings.EqualFold(email, invitation.Email) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "La invitación fue enviada a otro correo"})
+			return
+		}
+		uid = authTok.UID
+	} else {
+		inUse, err := emailInUse(authClient, invitation.Email)
+		if err != nil {
+			log.Printf("Error al verificar el correo %s: %v", invitation.Email, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+			return
+		}
+		if inUse {
+			c.JSON(http.StatusConflict, httputil.ErrorResponse{
+				Message: "Ya existe una cuenta con este correo; inicia sesión para aceptar la invitación",
+				Code:    ErrCodeAccountExists,
+			})
+			return
+		}
+		if !checkPasswordPolicy(c, passwordPolicy, "password", req.Password, invitation.Email, req.DisplayName) {
+			return
+		}
+	}
+
+	// Reservar la invitación antes de crear la cuenta para que no se acepte dos veces
+	acceptedAt := time.Now()
+	err = firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		if status, _ := doc.Data()["status"].(string); status != InvitationPending {
+			return errInvitationNotPending
+		}
+		return tx.Update(docRef, []firestore.Update{
+			{Path: "status", Value: InvitationAccepted},
+			{Path: "acceptedAt", Value: acceptedAt},
+		})
+	})
+	if err != nil {
+		respondInvitationError(c, invitation.ID, err)
+		return
+	}
+
+	created := uid == ""
+	if created {
+		uid, err = createInvitedUser(ctx, firestoreClient, authClient, invitation.Email, req.Password, req.DisplayName)
+	} else {
+		err = markInvitedUserVerified(ctx, firestoreClient, authClient, uid)
+	}
+	if err != nil {
+		log.Printf("Error al preparar la cuenta de la invitación %s: %v", invitation.ID, err)
+		// Liberar la invitación para que pueda volver a intentarse
+		if _, revertErr := docRef.Update(ctx, []firestore.Update{
+			{Path: "status", Value: InvitationPending},
+			{Path: "acceptedAt", Value: firestore.Delete},
+		}); revertErr != nil {
+			log.Printf("Error al liberar la invitación %s: %v", invitation.ID, revertErr)
+		}
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al crear la cuenta"})
+		return
+	}
+	if created {
+		recordPassword(passwordHistory, uid, req.Password)
+	}
+
+	if _, err := docRef.Update(ctx, []firestore.Update{{Path: "acceptedBy", Value: uid}}); err != nil {
+		log.Printf("Error al registrar quién aceptó la invitación %s: %v", invitation.ID, err)
+	}
+
+	role, err := applyInvitationRole(ctx, claimsManager, uid, invitation.Role)
+	if err != nil {
+		log.Printf("Error al asignar el rol de la invitación %s a %s: %v", invitation.ID, uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al asignar el rol"})
+		return
+	}
+
+	if invitation.OrgID != "" {
+		if err := applyInvitationMembership(ctx, store, invitation.OrgID, uid, invitation.OrgRole); err != nil {
+			log.Printf("Error al agregar a %s a la organización %s: %v", uid, invitation.OrgID, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al agregar a la organización"})
+			return
+		}
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionInvitationAccept,
+		ActorUID:   uid,
+		SubjectUID: uid,
+		Email:      invitation.Email,
+		Details:    map[string]interface{}{"invitationId": invitation.ID, "created": created, "role": role, "orgId": invitation.OrgID},
+	})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Invitación aceptada correctamente",
+		Data: map[string]interface{}{
+			"uid":     uid,
+			"created": created,
+			"role":    role,
+			"orgId":   invitation.OrgID,
+		},
+	})
+}
+
+// createInvitedUser crea una cuenta ya verificada para el correo invitado
+func createInvitedUser(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, email, password, displayName string) (string, error) {
+	params := (&auth.UserToCreate{}).Email(email).Password(password).EmailVerified(true)
+	if displayName = strings.TrimSpace(displayName); displayName != "" {
+		params = params.DisplayName(displayName)
+	}
+	user, err := authClient.CreateUser(ctx, params)
+	if err != nil {
+		return "", err
+	}
+
+	profile := map[string]interface{}{
+		"email":     email,
+		"createdAt": time.Now(),
+		"verified":  true,
+	}
+	if displayName != "" {
+		profile["displayName"] = displayName
+	}
+	if _, err := firestoreClient.Collection("users").Doc(user.UID).Set(ctx, profile); err != nil {
+		// Sin perfil la cuenta quedaría a medias y el correo ya no podría volver a invitarse
+		if delErr := authClient.DeleteUser(ctx, user.UID); delErr != nil {
+			log.Printf("Error al eliminar la cuenta incompleta %s: %v", user.UID, delErr)
+		}
+		return "", err
+	}
+	return user.UID, nil
+}
+
+// markInvitedUserVerified marca como verificada una cuenta existente que aceptó una invitación
+func markInvitedUserVerified(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, uid string) error {
+	if _, err := authClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).EmailVerified(true)); err != nil {
+		return err
+	}
+	_, err := firestoreClient.Collection("users").Doc(uid).Set(ctx, map[string]interface{}{
+		"verified": true,
+	}, firestore.MergeAll)
+	return err
+}
+
+// applyInvitationRole asigna el rol invitado (o el rol por defecto si el usuario no tiene uno) sin
+// reducir un rol superior que el usuario ya tenga. Devuelve el rol resultante.
+func applyInvitationRole(ctx context.Context, claimsManager *claims.Manager, uid, invitedRole string) (string, error) {
+	current, err := claimsManager.Get(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	currentRole, _ := current[claims.KeyRole].(string)
+
+	role := invitedRole
+	if role == "" {
+		role = authz.Roles().Default()
+	}
+	if currentRole != "" && authz.Roles().AtLeast(currentRole, role) {
+		return currentRole, nil
+	}
+
+	if _, err := claimsManager.Set(ctx, uid, claims.KeyRole, role); err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// applyInvitationMembership agrega al usuario a la organización sin reducir un rol superior que ya tenga
+func applyInvitationMembership(ctx context.Context, store orgs.Store, orgID, uid, orgRole string) error {
+	member, err := store.Member(ctx, orgID, uid)
+	if err != nil && !errors.Is(err, orgs.ErrNotMember) {
+		return err
+	}
+	if member != nil && orgs.Roles.AtLeast(member.Role, orgRole) {
+		return nil
+	}
+	_, err = store.SetMember(ctx, orgID, uid, orgRole)
+	return err
+}
+
+// sendInvitationMail envía el enlace firmado de la invitación
+func sendInvitationMail(invitation Invitation, orgName string) error {
+	token, err := utils.GenerarTokenConProposito(invitation.Email, "", utils.PurposeInvitation, invitation.ID, invitationTTL)
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		OrgName    string
+		AcceptLink string
+		ExpiresAt  string
+		Year       int
+	}{
+		OrgName:    orgName,
+		AcceptLink: fmt.Sprintf("%s/accept-invitation?token=%s", os.Getenv("URL_FRONTEND"), token),
+		ExpiresAt:  invitation.ExpiresAt.Format("02-01-2006"),
+		Year:       time.Now().Year(),
+	}
+	return sendTemplateMail(invitationT, invitation.Email, "Tienes una invitación", data)
+}
+
+// respondInvitationError responde con el código HTTP que corresponde a un error al leer o actualizar una invitación
+func respondInvitationError(c *gin.Context, id string, err error) {
+	switch {
+	case status.Code(err) == codes.NotFound:
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Invitación no encontrada"})
+	case errors.Is(err, errInvitationNotPending):
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La invitación ya no está pendiente"})
+	default:
+		log.Printf("Error en la invitación %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+	}
+}
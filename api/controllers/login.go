@@ -2,18 +2,40 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"backend/api/approvals"
+	"backend/api/audit"
 	"backend/api/httputil"
+	"backend/api/lockout"
+	"backend/api/notifications"
+	"backend/api/passwordhistory"
+	"backend/api/utils"
 
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
+// Códigos de error de la protección contra fuerza bruta
+const (
+	ErrCodeLoginThrottled           = "login_throttled"
+	ErrCodeAccountTemporarilyLocked = "account_temporarily_locked"
+)
+
+// LoginStatePasswordExpired indica que las credenciales son correctas pero la contraseña superó
+// PASSWORD_MAX_AGE; en lugar del token de sesión se entrega un resetToken para /change-password
+const LoginStatePasswordExpired = "password_expired"
+
 // Variables globales
 var (
 	firebaseAPIKey string
@@ -49,18 +71,41 @@ type LoginRequest struct {
 // @Accept json
 // @Produce json
 // @Param email body LoginRequest true "Datos de inicio de sesión"
-// @Success 200 {object} httputil.StandardResponse "Inicio de sesión exitoso"
+// @Success 200 {object} httputil.StandardResponse "Inicio de sesión exitoso, o state password_expired con resetToken si la contraseña expiró"
 // @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos o errores en la solicitud"
-// @Failure 401 {object} httputil.ErrorResponse "Credenciales incorrectas"
+// @Failure 401 {object} httputil.ErrorResponse "Credenciales incorrectas (invalid_credentials con protección contra enumeración)"
+// @Failure 403 {object} httputil.ErrorResponse "Cuenta desactivada, bloqueada, programada para eliminación, pendiente de aprobación o rechazada"
+// @Failure 429 {object} httputil.ErrorResponse "Demasiados intentos fallidos; ver Retry-After"
 // @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
 // @Router /login [post]
-func LoginUser(c *gin.Context) {
+func LoginUser(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, loginGuard *lockout.Guard, passwordHistory *passwordhistory.Store) {
 	var loginData LoginRequest
 	if err := c.BindJSON(&loginData); err != nil {
 		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
 		return
 	}
 
+	start := time.Now()
+
+	// Rechazar el intento si la cuenta o la IP están bloqueadas o en espera por intentos fallidos
+	ip := c.ClientIP()
+	decision, err := loginGuard.Check(context.Background(), loginData.Email, ip)
+	if err != nil {
+		log.Printf("Error al comprobar los intentos de inicio de sesión de %s: %v", loginData.Email, err)
+	} else if !decision.Allowed {
+		audit.Record(c, audit.Event{
+			Action:  audit.ActionLogin,
+			Outcome: audit.OutcomeFailure,
+			Email:   loginData.Email,
+			Details: map[string]interface{}{"reason": "throttled", "kind": decision.Kind, "locked": decision.Locked},
+		})
+		if enumerationProtection {
+			padResponse(start)
+		}
+		respondLoginThrottled(c, decision)
+		return
+	}
+
 	requestData := map[string]string{
 		"email":             loginData.Email,
 		"password":          loginData.Password,
@@ -92,20 +137,205 @@ func LoginUser(c *gin.Context) {
 
 	if errMsg, ok := result["error"].(map[string]interface{}); ok {
 		errorMessage := errMsg["message"].(string)
+		audit.Record(c, audit.Event{
+			Action:  audit.ActionLogin,
+			Outcome: audit.OutcomeFailure,
+			Email:   loginData.Email,
+			Details: map[string]interface{}{"reason": errorMessage},
+		})
+		if enumerationProtection {
+			// Una cuenta desactivada cuenta como intento fallido, igual que un correo sin cuenta, y todas
+			// las respuestas fallidas tardan lo mismo
+			if isCredentialFailure(errorMessage) || errorMessage == "USER_DISABLED" {
+				recordLoginFailure(c, firestoreClient, authClient, loginGuard, loginData.Email, ip)
+			}
+			padResponse(start)
+			if isCredentialFailure(errorMessage) {
+				respondInvalidCredentials(c)
+				return
+			}
+		} else if isCredentialFailure(errorMessage) {
+			recordLoginFailure(c, firestoreClient, authClient, loginGuard, loginData.Email, ip)
+		}
 		switch errorMessage {
 		case "EMAIL_NOT_FOUND":
 			c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
 		case "INVALID_PASSWORD":
 			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "Contraseña incorrecta"})
+		case "USER_DISABLED":
+			respondDisabledAccount(c, firestoreClient, authClient, loginData.Email)
 		default:
 			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: errorMessage})
 		}
 		return
 	}
 
+	localID, _ := result["localId"].(string)
+	audit.Record(c, audit.Event{Action: audit.ActionLogin, ActorUID: localID, SubjectUID: localID, Email: loginData.Email})
+
+	if err := loginGuard.RecordSuccess(context.Background(), loginData.Email); err != nil {
+		log.Printf("Error al reiniciar los intentos fallidos de %s: %v", loginData.Email, err)
+	}
+
+	// Las cuentas que esperan la aprobación de un administrador no reciben token de sesión
+	if doc, err := firestoreClient.Collection("users").Doc(localID).Get(context.Background()); err == nil {
+		if accountStatus, _ := doc.Data()["status"].(string); accountStatus == approvals.AccountStatusPendingApproval {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{
+				Message: "La cuenta está pendiente de aprobación por un administrador",
+				Code:    ErrCodeAccountPendingApproval,
+			})
+			return
+		}
+	}
+
+	// Las cuentas anteriores al historial lo inician con la contraseña actual
+	changedAt, err := passwordHistory.Seed(context.Background(), localID, loginData.Password)
+	if err != nil {
+		log.Printf("Error al iniciar el historial de contraseñas de %s: %v", localID, err)
+	}
+	if passwordHistory.Expired(changedAt) {
+		respondPasswordExpired(c, localID, loginData.Email)
+		return
+	}
+
+	// Avisar por correo si el inicio de sesión viene de un dispositivo o IP que no se había visto
+	userAgent := c.Request.UserAgent()
+	go func() {
+		if err := notifications.NewNotifier(firestoreClient).NotifyLogin(context.Background(), localID, loginData.Email, ip, userAgent); err != nil {
+			log.Printf("Error al registrar el dispositivo del inicio de sesión de %s: %v", localID, err)
+		}
+	}()
+
 	response := httputil.StandardResponse{
 		Message: "Inicio de sesión exitoso",
 		Data:    map[string]string{"token": result["idToken"].(string)},
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// respondDisabledAccount responde a un inicio de sesión en una cuenta desactivada, indicando si está
+// en el plazo de gracia antes de su eliminación para que el frontend ofrezca restaurarla. Con la
+// protección contra enumeración responde como credenciales incorrectas y el motivo se envía por correo.
+func respondDisabledAccount(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, email string) {
+	response := httputil.ErrorResponse{Message: "La cuenta está desactivada"}
+	if user, err := authClient.GetUserByEmail(context.Background(), email); err == nil {
+		response = disabledAccountResponse(firestoreClient, user.UID)
+	}
+
+	if enumerationProtection {
+		go func() {
+			if err := sendLoginBlockedMail(email, response.Message); err != nil {
+				log.Printf("Error al avisar el inicio de sesión rechazado a %s: %v", email, err)
+			}
+		}()
+		respondInvalidCredentials(c)
+		return
+	}
+	c.JSON(http.StatusForbidden, response)
+}
+
+// disabledAccountResponse explica por qué la cuenta desactivada no puede iniciar sesión
+func disabledAccountResponse(firestoreClient *firestore.Client, uid string) httputil.ErrorResponse {
+	job, err := scheduledDeletionFor(context.Background(), firestoreClient, uid)
+	if err != nil {
+		log.Printf("Error al obtener la eliminación programada de %s: %v", uid, err)
+	}
+	if job != nil {
+		return httputil.ErrorResponse{
+			Message: fmt.Sprintf("La cuenta está programada para eliminación el %s. Revisa tu correo para restaurarla.", job.PurgeAt.Format("02-01-2006")),
+			Code:    ErrCodeAccountScheduledForDeletion,
+		}
+	}
+	if doc, err := firestoreClient.Collection("users").Doc(uid).Get(context.Background()); err == nil {
+		switch accountStatus, _ := doc.Data()["status"].(string); accountStatus {
+		case accountStatusLocked:
+			return httputil.ErrorResponse{
+				Message: "La cuenta está bloqueada. Restablece tu contraseña con el enlace que enviamos a tu correo.",
+				Code:    ErrCodeAccountLocked,
+			}
+		case approvals.AccountStatusRejected:
+			return httputil.ErrorResponse{
+				Message: "La solicitud de cuenta fue rechazada",
+				Code:    ErrCodeRegistrationRejected,
+			}
+		}
+	}
+	return httputil.ErrorResponse{Message: "La cuenta está desactivada"}
+}
+
+// isCredentialFailure indica si el error de Identity Toolkit corresponde a credenciales incorrectas
+func isCredentialFailure(errorMessage string) bool {
+	switch errorMessage {
+	case "EMAIL_NOT_FOUND", "INVALID_PASSWORD", "INVALID_LOGIN_CREDENTIALS":
+		return true
+	}
+	return false
+}
+
+// respondLoginThrottled responde 429 con Retry-After cuando la cuenta o la IP no pueden intentar todavía
+func respondLoginThrottled(c *gin.Context, decision lockout.Decision) {
+	seconds := int(math.Ceil(decision.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	if decision.Locked {
+		c.JSON(http.StatusTooManyRequests, httputil.ErrorResponse{
+			Message: fmt.Sprintf("Demasiados intentos fallidos. Inténtalo de nuevo en %d minutos.", int(math.Ceil(decision.RetryAfter.Minutes()))),
+			Code:    ErrCodeAccountTemporarilyLocked,
+		})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, httputil.ErrorResponse{
+		Message: fmt.Sprintf("Demasiados intentos. Espera %d segundos antes de volver a intentarlo.", seconds),
+		Code:    ErrCodeLoginThrottled,
+	})
+}
+
+// recordLoginFailure registra un intento fallido y, si con él se bloquea la cuenta, avisa al usuario por correo
+func recordLoginFailure(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, loginGuard *lockout.Guard, email, ip string) {
+	result, err := loginGuard.RecordFailure(context.Background(), email, ip)
+	if err != nil {
+		log.Printf("Error al registrar el intento fallido de %s: %v", email, err)
+		return
+	}
+	if !result.AccountLocked {
+		return
+	}
+
+	user, err := authClient.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		// No se notifica a cuentas que no existen
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.ActionLoginLockout,
+		SubjectUID: user.UID,
+		Email:      email,
+		Details:    map[string]interface{}{"failures": result.Failures, "lockedUntil": result.LockedUntil},
+	})
+	go func() {
+		details := notifications.Details{IP: ip, LockedUntil: result.LockedUntil}
+		if err := notifications.NewNotifier(firestoreClient).Notify(context.Background(), user.UID, user.Email, notifications.EventAccountLocked, details); err != nil {
+			log.Printf("Error al notificar el bloqueo de la cuenta %s: %v", user.UID, err)
+		}
+	}()
+}
+
+// respondPasswordExpired responde a un inicio de sesión con la contraseña expirada. No se entrega el
+// token de sesión, sino un token de restablecimiento para cambiar la contraseña en /change-password.
+func respondPasswordExpired(c *gin.Context, uid, email string) {
+	resetToken, err := utils.GenerarToken(email, uid)
+	if err != nil {
+		log.Printf("Error al generar el token de restablecimiento de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "La contraseña expiró. Debes cambiarla para continuar.",
+		Data: map[string]string{
+			"state":      LoginStatePasswordExpired,
+			"resetToken": resetToken,
+		},
+	})
+}
@@ -0,0 +1,25 @@
+// backend/api/controllers/mail.go
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+
+	emailPkg "backend/api/email"
+)
+
+// sendTemplateMail ejecuta el template HTML con los datos dados y envía el correo resultante.
+func sendTemplateMail(t *template.Template, to, subject string, data interface{}) error {
+	var mailBody bytes.Buffer
+	if err := t.Execute(&mailBody, data); err != nil {
+		return fmt.Errorf("error al ejecutar el template HTML: %v", err)
+	}
+
+	if err := emailPkg.SendMail(emailPkg.SmtpConfigFromEnv(), to, subject, mailBody.String()); err != nil {
+		return fmt.Errorf("error al enviar el correo: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+// backend/api/controllers/notifications.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/httputil"
+	"backend/api/notifications"
+	"backend/api/utils"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCodeAccountLocked indica que la cuenta fue bloqueada desde un enlace "no fui yo"
+const ErrCodeAccountLocked = "account_locked"
+
+// accountStatusLocked es el estado del perfil de una cuenta bloqueada hasta que se restablezca la contraseña
+const accountStatusLocked = "locked"
+
+// statusBeforeLockField guarda el estado que tenía el perfil al bloquearse, para restaurarlo al reactivar la cuenta
+const statusBeforeLockField = "statusBeforeLock"
+
+// LockAccountRequest representa la solicitud para bloquear la cuenta desde una notificación
+type LockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// GetNotificationPreferences devuelve qué notificaciones de seguridad recibe el usuario.
+//
+// @Summary Preferencias de notificación
+// @Description Lista los eventos con notificación por correo, indicando cuáles están activos y cuáles son obligatorios.
+// @Tags notifications
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Preferencias de notificación"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /notifications/preferences [get]
+func GetNotificationPreferences(c *gin.Context, firestoreClient *firestore.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+
+	prefs, err := notifications.NewNotifier(firestoreClient).Preferences(context.Background(), token.(*auth.Token).UID)
+	if err != nil {
+		log.Printf("Error al obtener las preferencias de notificación: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener las preferencias de notificación"})
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Preferencias de notificación", Data: prefs})
+}
+
+// UpdateNotificationPreferences activa o desactiva las notificaciones opcionales.
+//
+// El cuerpo es un objeto con el evento como clave y true/false como valor, por ejemplo
+// {"new_login": false}. Las notificaciones obligatorias (contraseña, correo y verificación en dos pasos)
+// no se pueden desactivar.
+//
+// @Summary Actualizar preferencias de notificación
+// @Description Activa o desactiva las notificaciones de seguridad opcionales.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body map[string]bool true "Preferencias por evento"
+// @Success 200 {object} httputil.StandardResponse "Preferencias actualizadas"
+// @Failure 400 {object} httputil.ErrorResponse "Evento desconocido u obligatorio"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /notifications/preferences [put]
+func UpdateNotificationPreferences(c *gin.Context, firestoreClient *firestore.Client) {
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	uid := token.(*auth.Token).UID
+
+	var req map[notifications.Event]bool
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	notifier := notifications.NewNotifier(firestoreClient)
+	if err := notifier.SetPreferences(context.Background(), uid, req); err != nil {
+		if errors.Is(err, notifications.ErrUnknownEvent) || errors.Is(err, notifications.ErrMandatory) {
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: err.Error()})
+			return
+		}
+		log.Printf("Error al guardar las preferencias de notificación de %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al guardar las preferencias de notificación"})
+		return
+	}
+
+	prefs, err := notifier.Preferences(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al obtener las preferencias de notificación: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener las preferencias de notificación"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionNotificationPrefs, Details: map[string]interface{}{"preferences": req}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Preferencias actualizadas", Data: prefs})
+}
+
+// LockAccount bloquea la cuenta desde el enlace "no fui yo" de una notificación de seguridad.
+//
+// La cuenta se desactiva en Firebase Auth, se cierran todas las sesiones y se envía un enlace para
+// restablecer la contraseña a la dirección que recibió la notificación. Al cambiar la contraseña con
+// ese enlace la cuenta se reactiva.
+//
+// @Summary Bloquear cuenta
+// @Description Bloquea la cuenta, revoca las sesiones e inicia el restablecimiento de la contraseña.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param body body LockAccountRequest true "Token del enlace de la notificación"
+// @Success 200 {object} httputil.StandardResponse "Cuenta bloqueada"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "Token inválido o expirado"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 409 {object} httputil.ErrorResponse "La cuenta está programada para eliminación"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /account/lock [post]
+func LockAccount(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+	var req LockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	claims, err := utils.VerificarTokenConProposito(req.Token, utils.PurposeAccountLock)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "Token inválido o expirado"})
+		return
+	}
+
+	ctx := context.Background()
+	user, err := authClient.GetUser(ctx, claims.UID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
+		return
+	}
+
+	userRef := firestoreClient.Collection("users").Doc(claims.UID)
+	doc, err := userRef.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("Error al obtener el perfil de %s: %v", claims.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al bloquear la cuenta"})
+		return
+	}
+	accountStatus := ""
+	if err == nil {
+		accountStatus, _ = doc.Data()["status"].(string)
+	}
+	if accountStatus == "pending_deletion" {
+		c.JSON(http.StatusConflict, httputil.ErrorResponse{Message: "La cuenta está programada para eliminación", Code: ErrCodeAccountScheduledForDeletion})
+		return
+	}
+
+	// Una cuenta ya desactivada (por un administrador, un rechazo o un bloqueo anterior) no se toca: si se
+	// bloqueara, el restablecimiento de contraseña posterior la reactivaría
+	if user.Disabled || accountStatus == accountStatusLocked {
+		audit.Record(c, audit.Event{
+			Action:     audit.ActionAccountLock,
+			Outcome:    audit.OutcomeFailure,
+			ActorUID:   claims.UID,
+			SubjectUID: claims.UID,
+			Email:      claims.Email,
+			Details:    map[string]interface{}{"reason": "already_disabled"},
+		})
+		c.JSON(http.StatusOK, httputil.StandardResponse{
+			Message: "La cuenta ya estaba desactivada, por lo que no se realizaron cambios ni se envió un correo.",
+		})
+		return
+	}
+
+	if _, err := authClient.UpdateUser(ctx, claims.UID, (&auth.UserToUpdate{}).Disabled(true)); err != nil {
+		log.Printf("Error al desactivar la cuenta %s: %v", claims.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al bloquear la cuenta"})
+		return
+	}
+	if err := authClient.RevokeRefreshTokens(ctx, claims.UID); err != nil {
+		log.Printf("Advertencia: no se pudieron revocar las sesiones del usuario %s: %v", claims.UID, err)
+	}
+
+	lockFields := map[string]interface{}{
+		"status":   accountStatusLocked,
+		"lockedAt": time.Now(),
+	}
+	if accountStatus != "" {
+		lockFields[statusBeforeLockField] = accountStatus
+	}
+	_, err = userRef.Set(ctx, lockFields, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Advertencia: no se pudo actualizar el perfil del usuario %s: %v", claims.UID, err)
+	}
+
+	if err := sendPasswordReset(firestoreClient, claims.UID, claims.Email); err != nil {
+		log.Printf("Error al enviar el restablecimiento de contraseña a %s: %v", claims.Email, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "La cuenta fue bloqueada, pero no se pudo enviar el correo de restablecimiento"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionAccountLock, ActorUID: claims.UID, SubjectUID: claims.UID, Email: claims.Email})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "La cuenta fue bloqueada. Te enviamos un correo para restablecer la contraseña.",
+	})
+}
+
+// unlockAfterPasswordReset reactiva una cuenta bloqueada desde una notificación una vez que se cambió la
+// contraseña y le devuelve el estado que tenía antes del bloqueo. Solo actúa sobre cuentas que desactivó
+// LockAccount: si un administrador la desactivó después, se quitan los datos del bloqueo al hacerlo.
+func unlockAfterPasswordReset(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, uid string) error {
+	userRef := firestoreClient.Collection("users").Doc(uid)
+	doc, err := userRef.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if accountStatus, _ := doc.Data()["status"].(string); accountStatus != accountStatusLocked {
+		return nil
+	}
+
+	if _, err := authClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).Disabled(false)); err != nil {
+		return err
+	}
+	return clearAccountLock(ctx, firestoreClient, uid)
+}
+
+// clearAccountLock quita el bloqueo desde una notificación del perfil y restaura el estado anterior, sin
+// cambiar si la cuenta está desactivada. No hace nada si la cuenta no está bloqueada.
+func clearAccountLock(ctx context.Context, firestoreClient *firestore.Client, uid string) error {
+	userRef := firestoreClient.Collection("users").Doc(uid)
+	return firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data := doc.Data()
+		if accountStatus, _ := data["status"].(string); accountStatus != accountStatusLocked {
+			return nil
+		}
+
+		var previousStatus interface{} = firestore.Delete
+		if value, _ := data[statusBeforeLockField].(string); value != "" {
+			previousStatus = value
+		}
+		return tx.Set(userRef, map[string]interface{}{
+			"status":              previousStatus,
+			"lockedAt":            firestore.Delete,
+			statusBeforeLockField: firestore.Delete,
+		}, firestore.MergeAll)
+	})
+}
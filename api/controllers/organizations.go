@@ -0,0 +1,374 @@
+// backend/api/controllers/organizations.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/api/audit"
+	"backend/api/claims"
+	"backend/api/httputil"
+	"backend/api/orgs"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOrganizationRequest representa la solicitud para crear una organización
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// SetMemberRequest representa la solicitud para agregar un miembro o cambiar su rol
+type SetMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// CreateOrganization crea una organización con el usuario autenticado como propietario.
+//
+// @Summary Crear organización
+// @Description Crea una organización (en Firestore o como tenant de Firebase Auth según ORG_BACKEND) con el usuario como propietario.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body CreateOrganizationRequest true "Datos de la organización"
+// @Success 201 {object} httputil.StandardResponse "Organización creada"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations [post]
+func CreateOrganization(c *gin.Context, store orgs.Store) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	uid := c.MustGet("user").(*auth.Token).UID
+	org, err := store.Create(context.Background(), strings.TrimSpace(req.Name), uid)
+	if err != nil {
+		log.Printf("Error al crear la organización %q: %v", req.Name, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al crear la organización"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionOrgCreate, Details: map[string]interface{}{"orgId": org.ID, "name": org.Name}})
+	c.JSON(http.StatusCreated, httputil.StandardResponse{Message: "Organización creada correctamente", Data: org})
+}
+
+// ListMyOrganizations lista las organizaciones del usuario autenticado y su rol en cada una.
+//
+// @Summary Mis organizaciones
+// @Description Lista las organizaciones a las que pertenece el usuario autenticado.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Organizaciones"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations [get]
+func ListMyOrganizations(c *gin.Context, store orgs.Store) {
+	token := c.MustGet("user").(*auth.Token)
+	ctx := context.Background()
+
+	memberships, err := store.UserMemberships(ctx, token.UID)
+	if err != nil {
+		log.Printf("Error al listar las organizaciones de %s: %v", token.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	current, _ := token.Claims[claims.KeyOrg].(string)
+	result := []map[string]interface{}{}
+	for _, membership := range memberships {
+		org, err := store.Get(ctx, membership.OrgID)
+		if errors.Is(err, orgs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error al obtener la organización %s: %v", membership.OrgID, err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+			return
+		}
+		result = append(result, map[string]interface{}{
+			"organization": org,
+			"role":         membership.Role,
+			"current":      membership.OrgID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Organizaciones obtenidas correctamente", Data: result})
+}
+
+// GetOrganization devuelve una organización de la que el usuario es miembro.
+//
+// @Summary Obtener organización
+// @Description Devuelve la organización y el rol del usuario en ella.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param orgId path string true "ID de la organización"
+// @Success 200 {object} httputil.StandardResponse "Organización"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "No perteneces a esta organización"
+// @Failure 404 {object} httputil.ErrorResponse "Organización no encontrada"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations/{orgId} [get]
+func GetOrganization(c *gin.Context, store orgs.Store) {
+	org, err := store.Get(context.Background(), c.Param("orgId"))
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Organización obtenida correctamente",
+		Data: map[string]interface{}{
+			"organization": org,
+			"role":         c.MustGet("orgMember").(*orgs.Member).Role,
+		},
+	})
+}
+
+// ListOrganizationMembers lista los miembros de una organización.
+//
+// @Summary Listar miembros
+// @Description Lista los miembros de la organización y sus roles.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param orgId path string true "ID de la organización"
+// @Success 200 {object} httputil.StandardResponse "Miembros"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "No perteneces a esta organización"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations/{orgId}/members [get]
+func ListOrganizationMembers(c *gin.Context, store orgs.Store) {
+	members, err := store.Members(context.Background(), c.Param("orgId"))
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Miembros obtenidos correctamente", Data: members})
+}
+
+// SetOrganizationMember agrega un usuario a la organización o cambia su rol.
+//
+// Solo los administradores de la organización pueden hacerlo, sin asignar un rol superior al propio ni
+// modificar a un miembro con un rol superior. La organización siempre conserva al menos un propietario.
+//
+// @Summary Agregar miembro o cambiar su rol
+// @Description Agrega al usuario a la organización con el rol indicado (member, admin u owner) o cambia su rol.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param orgId path string true "ID de la organización"
+// @Param uid path string true "UID del usuario"
+// @Param body body SetMemberRequest true "Rol en la organización"
+// @Success 200 {object} httputil.StandardResponse "Miembro actualizado"
+// @Failure 400 {object} httputil.ErrorResponse "Rol inválido o la organización quedaría sin propietario"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations/{orgId}/members/{uid} [put]
+func SetOrganizationMember(c *gin.Context, store orgs.Store, authClient *auth.Client, claimsManager *claims.Manager) {
+	var req SetMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+	if !orgs.Roles.Valid(req.Role) {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Rol inválido"})
+		return
+	}
+
+	ctx := context.Background()
+	orgID, uid := c.Param("orgId"), c.Param("uid")
+	caller := c.MustGet("orgMember").(*orgs.Member)
+
+	if !orgs.Roles.AtLeast(caller.Role, req.Role) {
+		c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No puedes asignar un rol superior al tuyo"})
+		return
+	}
+
+	if _, err := authClient.GetUser(ctx, uid); err != nil {
+		respondAdminUserError(c, uid, err)
+		return
+	}
+
+	target, err := store.Member(ctx, orgID, uid)
+	if err != nil && !errors.Is(err, orgs.ErrNotMember) {
+		respondOrgError(c, err)
+		return
+	}
+	if target != nil {
+		if !orgs.Roles.AtLeast(caller.Role, target.Role) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No puedes modificar a un miembro con un rol superior al tuyo"})
+			return
+		}
+		if target.Role == orgs.RoleOwner && req.Role != orgs.RoleOwner && !ensureAnotherOwner(c, store, orgID) {
+			return
+		}
+	}
+
+	member, err := store.SetMember(ctx, orgID, uid, req.Role)
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	if err := syncOrgClaims(ctx, claimsManager, uid, orgID, req.Role); err != nil {
+		log.Printf("Error al actualizar los claims de organización de %s: %v", uid, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionOrgMemberSet, SubjectUID: uid, Details: map[string]interface{}{"orgId": orgID, "role": req.Role}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Miembro actualizado correctamente", Data: member})
+}
+
+// RemoveOrganizationMember quita a un usuario de la organización.
+//
+// Cualquier miembro puede salir de la organización; para quitar a otro miembro se requiere ser
+// administrador y tener un rol igual o superior al suyo.
+//
+// @Summary Quitar miembro
+// @Description Quita al usuario de la organización.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param orgId path string true "ID de la organización"
+// @Param uid path string true "UID del usuario"
+// @Success 200 {object} httputil.StandardResponse "Miembro eliminado"
+// @Failure 400 {object} httputil.ErrorResponse "La organización quedaría sin propietario"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Sin permisos"
+// @Failure 404 {object} httputil.ErrorResponse "El usuario no es miembro"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations/{orgId}/members/{uid} [delete]
+func RemoveOrganizationMember(c *gin.Context, store orgs.Store, claimsManager *claims.Manager) {
+	ctx := context.Background()
+	orgID, uid := c.Param("orgId"), c.Param("uid")
+	caller := c.MustGet("orgMember").(*orgs.Member)
+
+	target, err := store.Member(ctx, orgID, uid)
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	if caller.UID != uid && (!orgs.Roles.AtLeast(caller.Role, orgs.RoleAdmin) || !orgs.Roles.AtLeast(caller.Role, target.Role)) {
+		c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes permisos para realizar esta acción"})
+		return
+	}
+	if target.Role == orgs.RoleOwner && !ensureAnotherOwner(c, store, orgID) {
+		return
+	}
+
+	if err := store.RemoveMember(ctx, orgID, uid); err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	if err := syncOrgClaims(ctx, claimsManager, uid, orgID, ""); err != nil {
+		log.Printf("Error al actualizar los claims de organización de %s: %v", uid, err)
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionOrgMemberRemove, SubjectUID: uid, Details: map[string]interface{}{"orgId": orgID}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Miembro eliminado correctamente"})
+}
+
+// SwitchOrganization cambia la organización actual del usuario, guardada en los claims "org" y "orgRole".
+//
+// Los claims se incluyen en el token la próxima vez que el cliente lo renueve.
+//
+// @Summary Cambiar de organización
+// @Description Establece la organización actual del usuario en sus custom claims.
+// @Tags organizations
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param orgId path string true "ID de la organización"
+// @Success 200 {object} httputil.StandardResponse "Organización actual actualizada"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "No perteneces a esta organización"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /organizations/{orgId}/switch [post]
+func SwitchOrganization(c *gin.Context, claimsManager *claims.Manager) {
+	member := c.MustGet("orgMember").(*orgs.Member)
+
+	_, err := claimsManager.Merge(context.Background(), member.UID, map[string]interface{}{
+		claims.KeyOrg:     member.OrgID,
+		claims.KeyOrgRole: member.Role,
+	})
+	if err != nil {
+		log.Printf("Error al cambiar la organización de %s: %v", member.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al cambiar de organización"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionOrgSwitch, Details: map[string]interface{}{"orgId": member.OrgID}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Organización actual actualizada; renueva el token para aplicar el cambio",
+		Data:    member,
+	})
+}
+
+// syncOrgClaims actualiza orgRole si orgID es la organización actual del usuario. Con role vacío
+// (el usuario dejó la organización) se quitan los claims de organización.
+func syncOrgClaims(ctx context.Context, claimsManager *claims.Manager, uid, orgID, role string) error {
+	current, err := claimsManager.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if current[claims.KeyOrg] != orgID {
+		return nil
+	}
+
+	if role == "" {
+		_, err = claimsManager.Remove(ctx, uid, claims.KeyOrg, claims.KeyOrgRole)
+		return err
+	}
+	_, err = claimsManager.Set(ctx, uid, claims.KeyOrgRole, role)
+	return err
+}
+
+// ensureAnotherOwner verifica que la organización tenga más de un propietario; si no, responde con un error y devuelve false
+func ensureAnotherOwner(c *gin.Context, store orgs.Store, orgID string) bool {
+	members, err := store.Members(context.Background(), orgID)
+	if err != nil {
+		respondOrgError(c, err)
+		return false
+	}
+
+	owners := 0
+	for _, member := range members {
+		if member.Role == orgs.RoleOwner {
+			owners++
+		}
+	}
+	if owners <= 1 {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "La organización debe conservar al menos un propietario"})
+		return false
+	}
+	return true
+}
+
+// respondOrgError responde con el código HTTP que corresponde a un error del Store de organizaciones
+func respondOrgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, orgs.ErrNotFound):
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Organización no encontrada"})
+	case errors.Is(err, orgs.ErrNotMember):
+		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "El usuario no es miembro de la organización"})
+	default:
+		log.Printf("Error en la organización %s: %v", c.Param("orgId"), err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+	}
+}
@@ -0,0 +1,95 @@
+// backend/api/controllers/password_policy.go
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/api/httputil"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Códigos de error de la política de contraseñas
+const (
+	// ErrCodeWeakPassword indica que la contraseña no cumple la política; el detalle va en errors
+	ErrCodeWeakPassword = "weak_password"
+	// ErrCodePasswordReused indica que la contraseña coincide con una de las últimas usadas
+	ErrCodePasswordReused = "password_reused"
+)
+
+// GetPasswordPolicy devuelve los requisitos de las contraseñas para que el frontend los muestre y valide.
+//
+// @Summary Política de contraseñas
+// @Description Devuelve la longitud, las clases de caracteres y la fortaleza mínima exigidas, y si se comprueban filtraciones.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} httputil.StandardResponse "Política de contraseñas"
+// @Router /password-policy [get]
+func GetPasswordPolicy(c *gin.Context, policy *passwordpolicy.Policy) {
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Política de contraseñas",
+		Data:    policy.Rules(),
+	})
+}
+
+// checkPasswordPolicy valida la contraseña y, si no cumple la política, responde 400 con un error por
+// regla incumplida. userInputs son el correo y el nombre del usuario. Devuelve false si ya respondió.
+func checkPasswordPolicy(c *gin.Context, policy *passwordpolicy.Policy, field, password string, userInputs ...string) bool {
+	violations, err := policy.Check(password, userInputs...)
+	if err != nil {
+		// Si no se puede consultar el conjunto de filtraciones se aplican igualmente las demás reglas
+		log.Printf("Advertencia: %v", err)
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	fieldErrors := make([]httputil.FieldError, 0, len(violations))
+	for _, violation := range violations {
+		fieldErrors = append(fieldErrors, httputil.FieldError{Field: field, Code: violation.Code, Message: violation.Message})
+	}
+	c.JSON(http.StatusBadRequest, httputil.ErrorResponse{
+		Message: "La contraseña no cumple la política de contraseñas",
+		Code:    ErrCodeWeakPassword,
+		Errors:  fieldErrors,
+	})
+	return false
+}
+
+// checkPasswordHistory responde 400 si la contraseña coincide con una de las últimas del usuario.
+// Devuelve false si ya respondió.
+func checkPasswordHistory(c *gin.Context, passwordHistory *passwordhistory.Store, uid, field, password string) bool {
+	reused, err := passwordHistory.Reused(context.Background(), uid, password)
+	if err != nil {
+		// Sin historial disponible no se bloquea el cambio de contraseña
+		log.Printf("Advertencia: %v", err)
+		return true
+	}
+	if !reused {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, httputil.ErrorResponse{
+		Message: "La contraseña ya se usó recientemente",
+		Code:    ErrCodePasswordReused,
+		Errors: []httputil.FieldError{{
+			Field:   field,
+			Code:    ErrCodePasswordReused,
+			Message: fmt.Sprintf("No puedes reutilizar ninguna de tus últimas %d contraseñas", passwordHistory.Size),
+		}},
+	})
+	return false
+}
+
+// recordPassword guarda la contraseña recién establecida en el historial del usuario
+func recordPassword(passwordHistory *passwordhistory.Store, uid, password string) {
+	if err := passwordHistory.Record(context.Background(), uid, password); err != nil {
+		log.Printf("Error al guardar el historial de contraseñas de %s: %v", uid, err)
+	}
+}
@@ -0,0 +1,128 @@
+// backend/api/controllers/reauthenticate.go
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/api/audit"
+	"backend/api/httputil"
+	"backend/api/lockout"
+	"backend/api/middleware"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ReauthenticateRequest representa los datos para volver a autenticarse
+type ReauthenticateRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// Reauthenticate registra una prueba reciente de la contraseña del usuario.
+//
+// Las operaciones sensibles (cambio de contraseña, eliminación de foto, cambio de correo y eliminación
+// de cuenta) exigen que el usuario se haya autenticado hace pocos minutos. Este endpoint verifica la
+// contraseña con Firebase Authentication y guarda el momento en users/{uid}.authTime, que solo vale para
+// la sesión que se re-autenticó; el token que devuelve ya cuenta como autenticación reciente. Los intentos
+// fallidos cuentan para el mismo bloqueo por cuenta e IP que /login.
+//
+// @Summary Volver a autenticarse
+// @Description Verifica la contraseña del usuario autenticado y registra el momento de la autenticación.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body ReauthenticateRequest true "Contraseña del usuario"
+// @Success 200 {object} httputil.StandardResponse "Re-autenticación exitosa"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "Contraseña incorrecta"
+// @Failure 429 {object} httputil.ErrorResponse "Demasiados intentos fallidos; ver Retry-After"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /reauthenticate [post]
+func Reauthenticate(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, loginGuard *lockout.Guard) {
+	var req ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	session := token.(*auth.Token)
+	uid := session.UID
+
+	user, err := authClient.GetUser(context.Background(), uid)
+	if err != nil {
+		log.Printf("Error al obtener usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al obtener información del usuario"})
+		return
+	}
+
+	ip := c.ClientIP()
+	decision, err := loginGuard.Check(context.Background(), user.Email, ip)
+	if err != nil {
+		log.Printf("Error al comprobar los intentos de re-autenticación de %s: %v", uid, err)
+	} else if !decision.Allowed {
+		audit.Record(c, audit.Event{
+			Action:  audit.ActionReauthenticate,
+			Outcome: audit.OutcomeFailure,
+			Details: map[string]interface{}{"reason": "throttled", "kind": decision.Kind, "locked": decision.Locked},
+		})
+		respondLoginThrottled(c, decision)
+		return
+	}
+
+	result, err := identityToolkitPost("signInWithPassword", map[string]interface{}{
+		"email":             user.Email,
+		"password":          req.Password,
+		"returnSecureToken": true,
+	})
+	if err != nil {
+		var itErr *identityToolkitError
+		if errors.As(err, &itErr) {
+			audit.Record(c, audit.Event{Action: audit.ActionReauthenticate, Outcome: audit.OutcomeFailure})
+			if isCredentialFailure(itErr.Message) {
+				recordLoginFailure(c, firestoreClient, authClient, loginGuard, user.Email, ip)
+			}
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "Contraseña incorrecta"})
+			return
+		}
+		log.Printf("Error al re-autenticar al usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al comunicarse con Firebase"})
+		return
+	}
+
+	if err := loginGuard.RecordSuccess(context.Background(), user.Email); err != nil {
+		log.Printf("Error al reiniciar los intentos fallidos de %s: %v", user.Email, err)
+	}
+
+	authTime := time.Now()
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), map[string]interface{}{
+		"authTime":                    authTime,
+		middleware.ReauthSessionField: session.AuthTime,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al guardar authTime del usuario %s: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionReauthenticate})
+
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Re-autenticación exitosa",
+		Data: map[string]interface{}{
+			"token":    result["idToken"],
+			"authTime": authTime,
+		},
+	})
+}
@@ -1,17 +1,19 @@
 package controllers
 
 import (
-	emailPkg "backend/api/email"
+	"backend/api/audit"
+	"backend/api/domainpolicy"
 	"backend/api/httputil"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
+	"backend/api/verification"
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"html/template"
 	"log"
-	"math/rand"
 	"net/http"
-	"os"
-	"text/template"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -44,11 +46,11 @@ func init() {
 // @Produce json
 // @Param body body RegisterRequest true "Datos de registro del usuario"
 // @Success 200 {object} httputil.StandardResponse "Respuesta exitosa al registrar usuario"
-// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos, correo o dominio no permitido o contraseña que no cumple la política"
 // @Failure 401 {object} httputil.ErrorResponse "El correo electrónico ya está en uso"
 // @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
 // @Router /register [post]
-func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
+func RegisterUser(c *gin.Context, firestoreClient *firestore.Client, passwordPolicy *passwordpolicy.Policy, passwordHistory *passwordhistory.Store, domainPolicy *domainpolicy.Policy) {
 	// validar firestoreClient
 	if firestoreClient == nil {
 		log.Println("Firestore client no inicializado")
@@ -62,6 +64,15 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 		return
 	}
 
+	if err := domainPolicy.Check(context.Background(), registerData.Email); err != nil {
+		respondDomainPolicyError(c, "email", err)
+		return
+	}
+	if !checkPasswordPolicy(c, passwordPolicy, "password", registerData.Password, registerData.Email) {
+		return
+	}
+	start := time.Now()
+
 	requestData := map[string]interface{}{
 		"email":             registerData.Email,
 		"password":          registerData.Password,
@@ -95,6 +106,22 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 		errorMessage := errMsg["message"].(string)
 		switch errorMessage {
 		case "EMAIL_EXISTS":
+			if enumerationProtection {
+				// Se responde como un registro exitoso y se avisa al dueño del correo
+				go func() {
+					if err := sendAccountExistsMail(registerData.Email); err != nil {
+						log.Printf("Error al avisar del intento de registro a %s: %v", registerData.Email, err)
+					}
+				}()
+				audit.Record(c, audit.Event{
+					Action:  audit.ActionRegister,
+					Outcome: audit.OutcomeFailure,
+					Email:   registerData.Email,
+					Details: map[string]interface{}{"reason": errorMessage},
+				})
+				respondRegisteredUniformly(c, start, registerData.Email)
+				return
+			}
 			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "El correo electrónico ya está en uso"})
 		default:
 			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: errorMessage})
@@ -105,16 +132,22 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 	// Usuario creado exitosamente
 	uid := result["localId"].(string)
 	email := result["email"].(string)
-	verificationCode := generateVerificationCode() // Envío de correo de verificación
+	verificationCode, codeFields, err := verification.Registration.Issue(uid, 30*time.Minute)
+	if err != nil {
+		log.Printf("Error al generar el código de verificación: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al generar el código de verificación"})
+		return
+	}
 
-	// Guardar datos en Firestore
+	// Guardar datos en Firestore; el código solo se guarda como HMAC
 	docRef := firestoreClient.Collection("users").Doc(uid)
 	userData := map[string]interface{}{
-		"email":            email,
-		"createdAt":        time.Now(),
-		"verified":         false,
-		"verificationCode": verificationCode,
-		"codeValidUntil":   time.Now().Add(30 * time.Minute),
+		"email":     email,
+		"createdAt": time.Now(),
+		"verified":  false,
+	}
+	for field, value := range codeFields {
+		userData[field] = value
 	}
 	_, err = docRef.Set(context.Background(), userData)
 	if err != nil {
@@ -122,11 +155,9 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al guardar datos en Firestore"})
 		return
 	}
+	recordPassword(passwordHistory, uid, registerData.Password)
 
 	// Configurar y enviar el correo de verificación
-	mailSubject := "Código de verificación"
-
-	// Datos para el template HTML del correo
 	data := struct {
 		VerificationCode string
 		Email            string
@@ -139,28 +170,25 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 		Year:             time.Now().Year(),
 	}
 
-	var mailBody bytes.Buffer
-	if err := verificationT.Execute(&mailBody, data); err != nil {
-		log.Printf("Error al ejecutar el template HTML: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al procesar el template HTML"})
+	if enumerationProtection {
+		// El correo se envía en segundo plano para que la respuesta tarde lo mismo que con un correo ya registrado
+		go func() {
+			if err := sendTemplateMail(verificationT, email, "Código de verificación", data); err != nil {
+				log.Printf("Error al enviar el correo de verificación a %s: %v", email, err)
+			}
+		}()
+		audit.Record(c, audit.Event{Action: audit.ActionRegister, ActorUID: uid, SubjectUID: uid, Email: email})
+		respondRegisteredUniformly(c, start, email)
 		return
 	}
 
-	// Utiliza la función SendMail del paquete email
-	smtpConfig := emailPkg.SmtpConfig{
-		Host:     os.Getenv("SMTP_HOST"),
-		Port:     os.Getenv("SMTP_PORT"),
-		Username: os.Getenv("SMTP_USERNAME"),
-		Password: os.Getenv("SMTP_PASSWORD"),
-	}
-
-	err = emailPkg.SendMail(smtpConfig, email, mailSubject, mailBody.String())
-	if err != nil {
+	if err := sendTemplateMail(verificationT, email, "Código de verificación", data); err != nil {
 		log.Printf("Error al enviar el correo de verificación: %v", err)
 		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de verificación"})
 		return
 	}
 
+	audit.Record(c, audit.Event{Action: audit.ActionRegister, ActorUID: uid, SubjectUID: uid, Email: email})
 	response := httputil.StandardResponse{
 		Message: "Usuario registrado exitosamente. Se ha enviado un correo de verificación.",
 		Data:    map[string]string{"uid": uid, "email": email},
@@ -168,7 +196,36 @@ func RegisterUser(c *gin.Context, firestoreClient *firestore.Client) {
 	c.JSON(http.StatusOK, response)
 }
 
-// Función para generar un código de verificación (simulado)
-func generateVerificationCode() string {
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+// respondRegisteredUniformly responde un registro con la protección contra enumeración: la misma respuesta,
+// sin UID, exista o no la cuenta. El código se verifica luego con el correo en /verify-code.
+func respondRegisteredUniformly(c *gin.Context, start time.Time, email string) {
+	padResponse(start)
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Si el correo es válido, recibirás un mensaje para continuar con el registro.",
+		Data:    map[string]string{"email": email},
+	})
+}
+
+// Códigos de error de la política de dominios de registro
+const (
+	ErrCodeInvalidEmail          = "invalid_email"
+	ErrCodeEmailDomainNotAllowed = "email_domain_not_allowed"
+	ErrCodeDisposableEmail       = "disposable_email"
+)
+
+// respondDomainPolicyError responde 400 cuando el correo del campo field no cumple la política de dominios
+// de registro
+func respondDomainPolicyError(c *gin.Context, field string, err error) {
+	code, message := ErrCodeEmailDomainNotAllowed, "El dominio del correo electrónico no está permitido"
+	switch {
+	case errors.Is(err, domainpolicy.ErrInvalidEmail), errors.Is(err, domainpolicy.ErrNoMailServer):
+		code, message = ErrCodeInvalidEmail, "El correo electrónico no es válido"
+	case errors.Is(err, domainpolicy.ErrDisposable):
+		code, message = ErrCodeDisposableEmail, "No se aceptan correos electrónicos desechables"
+	}
+	c.JSON(http.StatusBadRequest, httputil.ErrorResponse{
+		Message: message,
+		Code:    code,
+		Errors:  []httputil.FieldError{{Field: field, Code: code, Message: err.Error()}},
+	})
 }
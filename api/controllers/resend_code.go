@@ -3,15 +3,11 @@
 package controllers
 
 import (
-	emailPkg "backend/api/email"
+	"backend/api/audit"
 	"backend/api/httputil"
-	"bytes"
-	"context"
+	"html/template"
 	"log"
 	"net/http"
-	"os"
-	"text/template"
-	"time"
 
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
@@ -66,59 +62,19 @@ func ResendCode(c *gin.Context, firestoreClient *firestore.Client) {
 	}
 
 	// Verificar si el código de verificación aún es válido
-	if IsVerificationCodeValid(userData.CodeValidUntil) {
+	if userData.CodeHash != "" && IsVerificationCodeValid(userData.CodeValidUntil) {
 		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "El código de verificación aún es válido"})
 		return
 	}
 
-	// Generar un nuevo código de verificación y actualizar los datos del usuario en Firestore
-	newVerificationCode := generateVerificationCode()
-	userData.VerificationCode = newVerificationCode
-	userData.CodeValidUntil = time.Now().Add(30 * time.Minute)
-
-	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), userData)
-	if err != nil {
-		log.Printf("Error al actualizar datos del usuario en Firestore: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar datos del usuario"})
-		return
-	}
-
-	// Configurar y enviar el correo de verificación
-	mailSubject := "Código de verificación"
-
-	data := struct {
-		VerificationCode string
-		Email            string
-		UID              string
-		Year             int
-	}{
-		VerificationCode: newVerificationCode,
-		Email:            userData.Email,
-		UID:              uid,
-		Year:             time.Now().Year(),
-	}
-
-	var mailBody bytes.Buffer
-	if err := verificationT.Execute(&mailBody, data); err != nil {
-		log.Printf("Error al ejecutar el template HTML: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al procesar el template HTML"})
-		return
-	}
-
-	smtpConfig := emailPkg.SmtpConfig{
-		Host:     os.Getenv("SMTP_HOST"),
-		Port:     os.Getenv("SMTP_PORT"),
-		Username: os.Getenv("SMTP_USERNAME"),
-		Password: os.Getenv("SMTP_PASSWORD"),
-	}
-
-	err = emailPkg.SendMail(smtpConfig, userData.Email, mailSubject, mailBody.String())
-	if err != nil {
-		log.Printf("Error al enviar el correo de verificación: %v", err)
+	// Generar un nuevo código de verificación, guardarlo en Firestore y enviarlo por correo
+	if err := issueVerificationCode(firestoreClient, uid, userData.Email); err != nil {
+		log.Printf("Error al reenviar el código de verificación: %v", err)
 		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al enviar el correo de verificación"})
 		return
 	}
 
+	audit.Record(c, audit.Event{Action: audit.ActionResendCode})
 	// Respuesta exitosa
 	response := httputil.StandardResponse{
 		Message: "Se ha enviado un nuevo correo de verificación.",
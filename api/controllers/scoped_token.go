@@ -0,0 +1,120 @@
+// backend/api/controllers/scoped_token.go
+
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ScopedTokenRequest representa la solicitud de un token restringido a algunos permisos
+type ScopedTokenRequest struct {
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// IssueScopedToken emite un token con el claim "scope" restringido a un subconjunto de los permisos del usuario.
+//
+// El token se obtiene canjeando un custom token con el claim "scope" en Firebase Authentication, de modo
+// que RequirePermission solo concede los permisos incluidos en el scope aunque el rol tenga más. Los
+// scopes solicitados deben estar dentro de los permisos efectivos del token actual, por lo que un token
+// restringido no puede usarse para obtener uno con más permisos.
+//
+// @Summary Emitir token con scopes
+// @Description Emite un ID token restringido a un subconjunto de los permisos del usuario autenticado.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Param body body ScopedTokenRequest true "Permisos solicitados"
+// @Success 200 {object} httputil.StandardResponse "Token emitido"
+// @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado"
+// @Failure 403 {object} httputil.ErrorResponse "Scopes no permitidos"
+// @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
+// @Router /token/scoped [post]
+func IssueScopedToken(c *gin.Context, authClient *auth.Client) {
+	var req ScopedTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+	authTok := token.(*auth.Token)
+
+	role, _ := authTok.Claims["role"].(string)
+	granted := authz.Permissions().Effective(role, authTok.Claims)
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !containsString(granted, scope) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes el permiso " + scope})
+			return
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
+		return
+	}
+	scope := strings.Join(scopes, " ")
+
+	customToken, err := authClient.CustomTokenWithClaims(context.Background(), authTok.UID, map[string]interface{}{
+		authz.ScopeClaim: scope,
+	})
+	if err != nil {
+		log.Printf("Error al crear el custom token de %s: %v", authTok.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al emitir el token"})
+		return
+	}
+
+	result, err := identityToolkitPost("signInWithCustomToken", map[string]interface{}{
+		"token":             customToken,
+		"returnSecureToken": true,
+	})
+	if err != nil {
+		log.Printf("Error al canjear el custom token de %s: %v", authTok.UID, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al comunicarse con Firebase"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.ActionScopedTokenIssue, Details: map[string]interface{}{"scope": scope}})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Token emitido correctamente",
+		Data: map[string]interface{}{
+			"token":        result["idToken"],
+			"refreshToken": result["refreshToken"],
+			"expiresIn":    result["expiresIn"],
+			"scope":        scope,
+		},
+	})
+}
+
+// containsString indica si la lista contiene el valor
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
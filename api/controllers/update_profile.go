@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 
+	"backend/api/audit"
 	"backend/api/httputil"
 
 	"cloud.google.com/go/firestore"
@@ -134,6 +135,7 @@ func UpdateProfile(c *gin.Context, firestoreClient *firestore.Client, authClient
 		}
 	}
 
+	audit.Record(c, audit.Event{Action: audit.ActionProfileUpdate})
 	// Retornar la respuesta al cliente
 	c.JSON(http.StatusOK, response)
 }
@@ -1,7 +1,9 @@
 package controllers
 
 import (
+	"backend/api/audit"
 	"backend/api/httputil"
+	"backend/api/notifications"
 	"context"
 	"fmt"
 	"io"
@@ -150,14 +152,76 @@ func UploadPhoto(c *gin.Context, firestoreClient *firestore.Client, storageClien
 		return
 	}
 
+	notifyPhotoChanged(firestoreClient, token.(*auth.Token))
+	audit.Record(c, audit.Event{Action: audit.ActionPhotoUpload})
 	c.JSON(http.StatusOK, httputil.StandardResponse{
 		Message: "Foto de perfil cargada correctamente",
 		Data:    userClaims,
 	})
 }
 
+// DeletePhoto maneja la solicitud para eliminar la foto de perfil del usuario.
+//
+// @Summary Eliminar foto de perfil
+// @Description Elimina la foto de perfil del usuario actual de Cloud Storage, Firestore y Firebase Authentication.
+// @Tags profile
+// @Produce json
+// @Param Authorization header string true "Token de autorización JWT"
+// @Success 200 {object} httputil.StandardResponse "Foto de perfil eliminada correctamente"
+// @Failure 401 {object} httputil.ErrorResponse "No autorizado o se requiere volver a autenticarse"
+// @Failure 500 {object} httputil.ErrorResponse "Error al eliminar la foto de perfil"
+// @Router /photo [delete]
+func DeletePhoto(c *gin.Context, firestoreClient *firestore.Client, storageClient *storage.Client, authClient *auth.Client) {
+	// Obtener el token de usuario del contexto
+	token, ok := c.Get("user")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+		return
+	}
+
+	// Extraer UID del token
+	uid := token.(*auth.Token).UID
+
+	// Eliminar todas las fotos del usuario en Cloud Storage
+	if err := deleteAllFromCloudStorage(uid, storageClient); err != nil {
+		log.Printf("Error al eliminar las fotos de Cloud Storage: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al eliminar la foto de perfil"})
+		return
+	}
+
+	// Quitar la URL de la foto de perfil en Firestore
+	_, err := firestoreClient.Collection("users").Doc(uid).Set(context.Background(), map[string]interface{}{
+		"photoURL": firestore.Delete,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("Error al actualizar usuario en Firestore: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al eliminar la foto de perfil"})
+		return
+	}
+
+	// Quitar la foto de perfil en Firebase Authentication (una URL vacía elimina el atributo)
+	_, err = authClient.UpdateUser(context.Background(), uid, (&auth.UserToUpdate{}).PhotoURL(""))
+	if err != nil {
+		log.Printf("Error al actualizar usuario en Firebase Auth: %v", err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al eliminar la foto de perfil"})
+		return
+	}
+
+	notifyPhotoChanged(firestoreClient, token.(*auth.Token))
+	audit.Record(c, audit.Event{Action: audit.ActionPhotoDelete})
+	c.JSON(http.StatusOK, httputil.StandardResponse{
+		Message: "Foto de perfil eliminada correctamente",
+	})
+}
+
 // deleteAllFromCloudStorage elimina todos los archivos de la carpeta del usuario en el almacenamiento en la nube.
 func deleteAllFromCloudStorage(uid string, client *storage.Client) error {
+	// Construir el prefijo del objeto en el bucket de almacenamiento
+	return deleteFromCloudStorageByPrefix(fmt.Sprintf("profile_photos/%s/", uid), client)
+}
+
+// deleteFromCloudStorageByPrefix elimina todos los objetos del bucket cuyo nombre comienza con el prefijo dado.
+func deleteFromCloudStorageByPrefix(prefix string, client *storage.Client) error {
 	// Configurar contexto y cliente para Google Cloud Storage
 	ctx := context.Background()
 
@@ -167,9 +231,6 @@ func deleteAllFromCloudStorage(uid string, client *storage.Client) error {
 		return fmt.Errorf("GCS_BUCKET_NAME no está configurado en las variables de entorno")
 	}
 
-	// Construir el prefijo del objeto en el bucket de almacenamiento
-	prefix := fmt.Sprintf("profile_photos/%s/", uid)
-
 	// Obtener todos los objetos en el bucket con el prefijo dado
 	it := client.Bucket(bucketName).Objects(ctx, &storage.Query{
 		Prefix: prefix,
@@ -237,3 +298,11 @@ func uploadToCloudStorage(uid, fileName, filePath string, client *storage.Client
 
 	return url, nil
 }
+
+// notifyPhotoChanged avisa por correo del cambio de foto, si el usuario no desactivó esa notificación
+func notifyPhotoChanged(firestoreClient *firestore.Client, token *auth.Token) {
+	email, _ := token.Claims["email"].(string)
+	if err := notifications.NewNotifier(firestoreClient).Notify(context.Background(), token.UID, email, notifications.EventPhotoChanged, notifications.Details{}); err != nil {
+		log.Printf("Error al notificar el cambio de foto de %s: %v", token.UID, err)
+	}
+}
@@ -4,10 +4,13 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"html/template"
 	"log"
-	"text/template"
 	"time"
 
+	"backend/api/verification"
+
 	"cloud.google.com/go/firestore"
 	"github.com/joho/godotenv"
 )
@@ -35,10 +38,11 @@ type RegisterRequest struct {
 
 // UserData representa los datos del usuario en Firestore
 type UserData struct {
-	Email            string    `firestore:"email"`
-	Verified         bool      `firestore:"verified"`
-	VerificationCode string    `firestore:"verificationCode"`
-	CodeValidUntil   time.Time `firestore:"codeValidUntil"`
+	Email          string    `firestore:"email"`
+	Verified       bool      `firestore:"verified"`
+	CodeValidUntil time.Time `firestore:"codeValidUntil"`
+	// CodeHash es el HMAC del código pendiente; está vacío si el código se invalidó por intentos fallidos
+	CodeHash string `firestore:"verificationCodeHash"`
 }
 
 // Función auxiliar para obtener los datos del usuario desde Firestore
@@ -62,3 +66,29 @@ func GetUserData(uid string, firestoreClient *firestore.Client) (UserData, error
 func IsVerificationCodeValid(codeValidUntil time.Time) bool {
 	return time.Now().Before(codeValidUntil)
 }
+
+// issueVerificationCode genera un nuevo código de verificación, lo guarda en users/{uid} y lo envía por correo.
+func issueVerificationCode(firestoreClient *firestore.Client, uid, email string) error {
+	verificationCode, codeFields, err := verification.Registration.Issue(uid, 30*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	_, err = firestoreClient.Collection("users").Doc(uid).Set(context.Background(), codeFields, firestore.MergeAll)
+	if err != nil {
+		return fmt.Errorf("error al actualizar datos del usuario en Firestore: %v", err)
+	}
+
+	data := struct {
+		VerificationCode string
+		Email            string
+		UID              string
+		Year             int
+	}{
+		VerificationCode: verificationCode,
+		Email:            email,
+		UID:              uid,
+		Year:             time.Now().Year(),
+	}
+	return sendTemplateMail(verificationT, email, "Código de verificación", data)
+}
@@ -1,8 +1,10 @@
 package controllers
 
 import (
+	"backend/api/claims"
 	"backend/api/httputil"
 	"context"
+	"log"
 	"net/http"
 
 	"firebase.google.com/go/auth"
@@ -10,7 +12,7 @@ import (
 )
 
 // ValidateToken verifica y devuelve la información del token validado.
-func ValidateToken(c *gin.Context, authClient *auth.Client) {
+func ValidateToken(c *gin.Context, authClient *auth.Client, claimsManager *claims.Manager) {
 	// Obtener el token de usuario del contexto
 	token, ok := c.Get("user")
 	if !ok {
@@ -34,8 +36,9 @@ func ValidateToken(c *gin.Context, authClient *auth.Client) {
 
 	// Actualizar los claims del token si es necesario
 	if needToUpdateClaims(authTok.Claims, userInfo) {
-		err := updateClaims(authClient, authTok.UID, userInfo)
+		err := updateClaims(claimsManager, authTok.UID, userInfo)
 		if err != nil {
+			log.Printf("Error al actualizar los claims del usuario %s: %v", authTok.UID, err)
 			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error al actualizar los claims"})
 			return
 		}
@@ -74,11 +77,11 @@ func needToUpdateClaims(claims map[string]interface{}, userInfo map[string]inter
 	return claims["name"] != userInfo["displayName"] || claims["picture"] != userInfo["photoURL"]
 }
 
-// updateClaims actualiza los claims del token de usuario.
-func updateClaims(authClient *auth.Client, uid string, userInfo map[string]interface{}) error {
-	claims := map[string]interface{}{
-		"name":    userInfo["displayName"],
-		"picture": userInfo["photoURL"],
-	}
-	return authClient.SetCustomUserClaims(context.Background(), uid, claims)
+// updateClaims actualiza los claims del token de usuario, conservando los demás custom claims (como el rol).
+func updateClaims(claimsManager *claims.Manager, uid string, userInfo map[string]interface{}) error {
+	_, err := claimsManager.Merge(context.Background(), uid, map[string]interface{}{
+		claims.KeyName:    userInfo["displayName"],
+		claims.KeyPicture: userInfo["photoURL"],
+	})
+	return err
 }
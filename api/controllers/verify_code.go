@@ -1,19 +1,29 @@
 package controllers
 
 import (
+	"backend/api/approvals"
+	"backend/api/audit"
+	"backend/api/claims"
+	"backend/api/domainpolicy"
 	"backend/api/httputil"
+	"backend/api/verification"
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"time"
 
 	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type VerifyCodeRequest struct {
-	UID              string `json:"uid"`
+	UID string `json:"uid"`
+	// Email identifica al usuario cuando no se conoce el UID (registro con protección contra enumeración)
+	Email            string `json:"email"`
 	VerificationCode string `json:"verificationCode"`
 }
 
@@ -22,7 +32,7 @@ type VerifyCodeRequest struct {
 // Este endpoint verifica si el código proporcionado por el usuario coincide con el
 // código almacenado en Firestore para el usuario identificado por UID. Si el código
 // es correcto y aún no se ha verificado, marca al usuario como verificado y asigna
-// el rol de "miembro" como un custom claim en Firebase Auth.
+// el rol de su dominio (o el de menor privilegio) como un custom claim en Firebase Auth.
 //
 // @Summary Verifica el código de verificación de un usuario.
 // @Description Verifica el código de verificación de un usuario en Firestore y Firebase Auth.
@@ -30,82 +40,199 @@ type VerifyCodeRequest struct {
 // @Accept json
 // @Produce json
 // @Param body body VerifyCodeRequest true "Datos de la solicitud"
-// @Success 200 {object} httputil.StandardResponse "Usuario verificado"
+// @Success 200 {object} httputil.StandardResponse "Usuario verificado, o state pending_approval si la cuenta requiere aprobación"
 // @Failure 400 {object} httputil.ErrorResponse "Datos de solicitud inválidos"
 // @Failure 401 {object} httputil.ErrorResponse "Código de verificación incorrecto"
-// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado"
+// @Failure 404 {object} httputil.ErrorResponse "Usuario no encontrado (sin protección contra enumeración)"
 // @Failure 500 {object} httputil.ErrorResponse "Error interno del servidor"
 // @Router /verify-code [post]
-func VerifyCode(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client) {
+func VerifyCode(c *gin.Context, firestoreClient *firestore.Client, authClient *auth.Client, claimsManager *claims.Manager, domainPolicy *domainpolicy.Policy, approvalQueue *approvals.Queue) {
 	var req VerifyCodeRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Datos de solicitud inválidos"})
 		return
 	}
 
-	// acceder a la colección de usuarios
-	users := firestoreClient.Collection("users")
-
-	// verificar si el usuario existe
-	doc, err := users.Doc(req.UID).Get(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
-		return
+	if req.UID == "" && req.Email != "" {
+		user, err := authClient.GetUserByEmail(context.Background(), req.Email)
+		if err != nil {
+			respondUnknownVerificationUser(c)
+			return
+		}
+		req.UID = user.UID
 	}
-	if !doc.Exists() {
-		c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
+	if req.UID == "" {
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Se requiere uid o email"})
 		return
 	}
 
-	now := time.Now()
+	// acceder a la colección de usuarios
+	userRef := firestoreClient.Collection("users").Doc(req.UID)
 
-	// verificar que el codeValidUntil sea mayor a la fecha actual
-	userData := doc.Data()
-	codeValidUntil, ok := userData["codeValidUntil"].(time.Time)
-	if !ok || codeValidUntil.Before(now) {
-		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Código de verificación expirado"})
+	// El código se compara y se consume en una transacción junto con la marca de verificado, de modo que
+	// dos verificaciones concurrentes no puedan usar el mismo código ni saltarse el contador de intentos
+	err := verification.Registration.Verify(context.Background(), firestoreClient, userRef, req.UID, req.VerificationCode, func(data map[string]interface{}) (map[string]interface{}, error) {
+		if verified, _ := data["verified"].(bool); verified {
+			return nil, errAlreadyVerified
+		}
+		return map[string]interface{}{"verified": true}, nil
+	})
+	if status.Code(err) == codes.NotFound {
+		respondUnknownVerificationUser(c)
 		return
 	}
-
-	// verificar que el código de verificación sea correcto
-	verificationCode, ok := userData["verificationCode"].(string)
-	if !ok || verificationCode != req.VerificationCode {
-		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Código de verificación incorrecto"})
+	// El código se consume antes de marcar el correo en Firebase Auth y asignar el rol o pedir la aprobación;
+	// si alguno de esos pasos falló, al reintentar la cuenta ya figura verificada y sin código, así que se
+	// completan los pasos pendientes en lugar de responder que ya está verificada
+	if errors.Is(err, errAlreadyVerified) || errors.Is(err, verification.ErrNoCode) {
+		if doc, getErr := userRef.Get(context.Background()); getErr == nil {
+			if verified, _ := doc.Data()["verified"].(bool); verified {
+				result, finishErr := finishVerification(context.Background(), authClient, claimsManager, domainPolicy, approvalQueue, req.UID)
+				if finishErr != nil {
+					log.Printf("Error al completar la verificación de %s: %v", req.UID, finishErr)
+					c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+					return
+				}
+				if result.Completed {
+					respondVerified(c, req.UID, result)
+					return
+				}
+				err = errAlreadyVerified
+			}
+		}
+	}
+	// Sin protección contra enumeración se indica el motivo; con ella, un correo ya verificado o sin código
+	// pendiente responde igual que uno inexistente
+	if enumerationProtection && (errors.Is(err, errAlreadyVerified) || errors.Is(err, verification.ErrNoCode)) {
+		respondUnknownVerificationUser(c)
 		return
 	}
-
-	// verificar que el usuario no haya sido verificado previamente
-	verified, ok := userData["verified"].(bool)
-	if !ok || verified {
+	if errors.Is(err, errAlreadyVerified) {
 		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Usuario ya verificado"})
 		return
 	}
-
-	// marcar el usuario como verificado
-	_, err = users.Doc(req.UID).Set(c, map[string]interface{}{
-		"verified": true,
-	}, firestore.MergeAll)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+		if errors.Is(err, verification.ErrInvalidCode) || errors.Is(err, verification.ErrTooManyAttempts) {
+			audit.Record(c, audit.Event{Action: audit.ActionVerifyEmail, Outcome: audit.OutcomeFailure, SubjectUID: req.UID})
+		}
+		respondCodeError(c, err, "verificación", "No hay un código de verificación pendiente")
 		return
 	}
 
-	// marcar el usuario como verificado en Firebase Auth
-	_, err = authClient.UpdateUser(context.Background(), req.UID, (&auth.UserToUpdate{}).EmailVerified(true))
+	result, err := finishVerification(context.Background(), authClient, claimsManager, domainPolicy, approvalQueue, req.UID)
 	if err != nil {
-		log.Printf("Error al marcar usuario como verificado en Firebase Auth: %v", err)
+		log.Printf("Error al completar la verificación de %s: %v", req.UID, err)
 		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
 		return
 	}
+	respondVerified(c, req.UID, result)
+}
 
-	// Asignar el rol de miembro como custom claim
-	err = authClient.SetCustomUserClaims(context.Background(), req.UID, map[string]interface{}{"role": "member"})
+// verificationResult describe lo que hizo finishVerification
+type verificationResult struct {
+	Email string
+	// Completed indica que faltaba al menos un paso: marcar el correo, asignar el rol o pedir la aprobación
+	Completed bool
+	// PendingApproval indica que la cuenta queda pendiente de aprobación
+	PendingApproval bool
+	// ApprovalRequested indica que la solicitud de aprobación se creó en esta llamada
+	ApprovalRequested bool
+}
+
+// finishVerification completa los pasos posteriores a verificar el correo: lo marca como verificado en
+// Firebase Auth y asigna como custom claim el rol de su dominio (REGISTRATION_DOMAIN_ROLES) o el de menor
+// privilegio, salvo que el registro requiera aprobación, en cuyo caso crea la solicitud y el rol lo asigna
+// la aprobación. Los pasos ya hechos se omiten, de modo que se puede repetir tras un fallo a medias.
+func finishVerification(ctx context.Context, authClient *auth.Client, claimsManager *claims.Manager, domainPolicy *domainpolicy.Policy, approvalQueue *approvals.Queue, uid string) (verificationResult, error) {
+	user, err := authClient.GetUser(ctx, uid)
 	if err != nil {
-		log.Printf("Error al asignar rol de miembro: %v", err)
-		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
-		return
+		return verificationResult{}, err
+	}
+	result := verificationResult{Email: user.Email}
+
+	if !user.EmailVerified {
+		if user, err = authClient.UpdateUser(ctx, uid, (&auth.UserToUpdate{}).EmailVerified(true)); err != nil {
+			return result, fmt.Errorf("error al marcar el correo como verificado: %w", err)
+		}
+		result.Completed = true
 	}
 
+	if _, hasRole := user.CustomClaims[claims.KeyRole]; hasRole {
+		return result, nil
+	}
+
+	approval, err := approvalQueue.Get(ctx, uid)
+	switch {
+	case err == nil:
+		// Ya tiene una solicitud pendiente o rechazada
+		result.PendingApproval = approval.Status == approvals.StatusPending
+		return result, nil
+	case !errors.Is(err, approvals.ErrNotFound):
+		return result, fmt.Errorf("error al obtener la solicitud de aprobación: %w", err)
+	case approvalQueue.Enabled:
+		if err := requestApproval(approvalQueue, uid, user.Email); err != nil {
+			return result, fmt.Errorf("error al solicitar la aprobación: %w", err)
+		}
+		result.Completed, result.PendingApproval, result.ApprovalRequested = true, true, true
+		return result, nil
+	}
+
+	if _, err := claimsManager.Set(ctx, uid, claims.KeyRole, domainPolicy.RoleFor(user.Email)); err != nil {
+		return result, fmt.Errorf("error al asignar el rol: %w", err)
+	}
+	result.Completed = true
+	return result, nil
+}
+
+// respondVerified registra y responde la verificación del correo hecha por el propio usuario
+func respondVerified(c *gin.Context, uid string, result verificationResult) {
+	audit.Record(c, audit.Event{Action: audit.ActionVerifyEmail, ActorUID: uid, SubjectUID: uid})
+	if result.ApprovalRequested {
+		audit.Record(c, audit.Event{Action: audit.ActionRegistrationRequest, ActorUID: uid, SubjectUID: uid, Email: result.Email})
+	}
+	if result.PendingApproval {
+		c.JSON(http.StatusOK, httputil.StandardResponse{
+			Message: "Usuario verificado. La cuenta está pendiente de aprobación.",
+			Data:    map[string]string{"state": LoginStatePendingApproval},
+		})
+		return
+	}
 	c.JSON(http.StatusOK, httputil.StandardResponse{Message: "Usuario verificado"})
+}
+
+// ErrCodeTooManyCodeAttempts indica que el código se invalidó por exceso de intentos fallidos
+const ErrCodeTooManyCodeAttempts = "code_attempts_exceeded"
+
+// errAlreadyVerified indica que la cuenta ya estaba verificada al confirmar el código
+var errAlreadyVerified = errors.New("usuario ya verificado")
 
+// respondUnknownVerificationUser responde cuando el usuario no existe o ya está verificado; con la
+// protección contra enumeración se responde igual que a un código incorrecto
+func respondUnknownVerificationUser(c *gin.Context) {
+	if enumerationProtection {
+		respondCodeError(c, verification.ErrInvalidCode, "verificación", "")
+		return
+	}
+	c.JSON(http.StatusNotFound, httputil.ErrorResponse{Message: "Usuario no encontrado"})
+}
+
+// respondCodeError responde al error de verification.Verify. noun es "verificación" o "confirmación" y
+// noCodeMessage el mensaje cuando no hay un código pendiente.
+func respondCodeError(c *gin.Context, err error, noun, noCodeMessage string) {
+	switch {
+	case errors.Is(err, verification.ErrNoCode):
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: noCodeMessage})
+	case errors.Is(err, verification.ErrExpired):
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: fmt.Sprintf("Código de %s expirado", noun)})
+	case errors.Is(err, verification.ErrInvalidCode):
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: fmt.Sprintf("Código de %s incorrecto", noun)})
+	case errors.Is(err, verification.ErrTooManyAttempts):
+		c.JSON(http.StatusBadRequest, httputil.ErrorResponse{
+			Message: fmt.Sprintf("Se superó el máximo de intentos. Solicita un nuevo código de %s.", noun),
+			Code:    ErrCodeTooManyCodeAttempts,
+		})
+	default:
+		log.Printf("Error al verificar el código de %s: %v", noun, err)
+		c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+	}
 }
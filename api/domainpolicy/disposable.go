@@ -0,0 +1,139 @@
+// api/domainpolicy/disposable.go
+package domainpolicy
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed disposable_domains.txt
+var bundledDisposable string
+
+// disposableReloadInterval es cada cuánto se revisa si el archivo de dominios cambió
+const disposableReloadInterval = time.Minute
+
+// DisposableList es la lista de dominios de correo desechable. Sin archivo se usa la lista incluida;
+// con archivo, se vuelve a cargar cuando cambia su fecha de modificación.
+type DisposableList struct {
+	path string
+
+	mu        sync.RWMutex
+	domains   map[string]bool
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewBundledDisposableList crea la lista con los dominios incluidos en el binario
+func NewBundledDisposableList() *DisposableList {
+	domains, _ := parseDomainList(strings.NewReader(bundledDisposable))
+	return &DisposableList{domains: domains}
+}
+
+// OpenDisposableList carga la lista desde un archivo con un dominio por línea
+func OpenDisposableList(path string) (*DisposableList, error) {
+	list := &DisposableList{path: path}
+	if err := list.Reload(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Reload vuelve a leer el archivo de la lista. No hace nada con la lista incluida.
+func (l *DisposableList) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return fmt.Errorf("error al leer la lista de dominios desechables: %v", err)
+	}
+	file, err := os.Open(l.path)
+	if err != nil {
+		return fmt.Errorf("error al leer la lista de dominios desechables: %v", err)
+	}
+	defer file.Close()
+
+	domains, err := parseDomainList(file)
+	if err != nil {
+		return fmt.Errorf("error al leer la lista de dominios desechables: %v", err)
+	}
+
+	l.mu.Lock()
+	l.domains = domains
+	l.modTime = info.ModTime()
+	l.checkedAt = time.Now()
+	l.mu.Unlock()
+	return nil
+}
+
+// Contains indica si el dominio o alguno de sus dominios padre está en la lista
+func (l *DisposableList) Contains(domain string) bool {
+	l.reloadIfChanged()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for {
+		if l.domains[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// Len devuelve la cantidad de dominios de la lista
+func (l *DisposableList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.domains)
+}
+
+// reloadIfChanged recarga el archivo si cambió desde la última carga. Si falla se mantiene la lista anterior.
+func (l *DisposableList) reloadIfChanged() {
+	if l.path == "" {
+		return
+	}
+	l.mu.RLock()
+	due := time.Since(l.checkedAt) >= disposableReloadInterval
+	modTime := l.modTime
+	l.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	info, err := os.Stat(l.path)
+	if err == nil && info.ModTime().Equal(modTime) {
+		l.mu.Lock()
+		l.checkedAt = time.Now()
+		l.mu.Unlock()
+		return
+	}
+	if err := l.Reload(); err != nil {
+		l.mu.Lock()
+		l.checkedAt = time.Now()
+		l.mu.Unlock()
+	}
+}
+
+// parseDomainList lee un dominio por línea, ignorando líneas vacías y comentarios con #
+func parseDomainList(r io.Reader) (map[string]bool, error) {
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+	return domains, scanner.Err()
+}
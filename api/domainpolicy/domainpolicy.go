@@ -0,0 +1,227 @@
+// api/domainpolicy/domainpolicy.go
+package domainpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	"backend/api/authz"
+)
+
+var (
+	// ErrInvalidEmail indica que el correo no tiene un formato válido
+	ErrInvalidEmail = errors.New("el correo electrónico no es válido")
+	// ErrDomainNotAllowed indica que el dominio no está en la lista de dominios permitidos
+	ErrDomainNotAllowed = errors.New("el dominio del correo no está permitido")
+	// ErrDomainDenied indica que el dominio está bloqueado
+	ErrDomainDenied = errors.New("el dominio del correo está bloqueado")
+	// ErrDisposable indica que el dominio es de correo desechable
+	ErrDisposable = errors.New("no se aceptan correos desechables")
+	// ErrNoMailServer indica que el dominio no puede recibir correo
+	ErrNoMailServer = errors.New("el dominio del correo no recibe correos")
+)
+
+// Policy decide qué correos pueden registrarse y qué rol reciben al verificarse.
+//
+// Los patrones de dominio pueden ser un dominio exacto ("utem.cl"), sus subdominios ("*.utem.cl", que no
+// incluye a utem.cl) o cualquier dominio ("*").
+type Policy struct {
+	// Allow, si no está vacía, es la lista de los únicos dominios aceptados
+	Allow []string
+	// Deny son dominios rechazados aunque estén en Allow
+	Deny []string
+	// Disposable, si no es nil, rechaza los dominios de correo desechable
+	Disposable *DisposableList
+	// CheckMX exige que el dominio tenga registros MX (o, en su defecto, A/AAAA)
+	CheckMX bool
+	// DomainRoles asigna un rol por patrón de dominio al verificar el correo; el primero que coincide gana
+	DomainRoles []DomainRole
+}
+
+// DomainRole es el rol por defecto de los usuarios de un patrón de dominio
+type DomainRole struct {
+	Pattern string `json:"pattern"`
+	Role    string `json:"role"`
+}
+
+// NewFromEnv crea la política con:
+//   - REGISTRATION_ALLOWED_DOMAINS y REGISTRATION_DENIED_DOMAINS: patrones separados por comas
+//   - REGISTRATION_BLOCK_DISPOSABLE: "true" rechaza los correos desechables, con la lista incluida o la
+//     del archivo REGISTRATION_DISPOSABLE_PATH (se recarga al modificarse)
+//   - REGISTRATION_CHECK_MX: "true" exige que el dominio reciba correo
+//   - REGISTRATION_DOMAIN_ROLES: "patrón=rol" separados por comas, por ejemplo "utem.cl=staff"
+func NewFromEnv() (*Policy, error) {
+	policy := &Policy{
+		Allow: splitPatterns(os.Getenv("REGISTRATION_ALLOWED_DOMAINS")),
+		Deny:  splitPatterns(os.Getenv("REGISTRATION_DENIED_DOMAINS")),
+	}
+
+	blockDisposable, err := envBool("REGISTRATION_BLOCK_DISPOSABLE")
+	if err != nil {
+		return nil, err
+	}
+	if blockDisposable {
+		if path := strings.TrimSpace(os.Getenv("REGISTRATION_DISPOSABLE_PATH")); path != "" {
+			if policy.Disposable, err = OpenDisposableList(path); err != nil {
+				return nil, err
+			}
+		} else {
+			policy.Disposable = NewBundledDisposableList()
+		}
+	}
+
+	if policy.CheckMX, err = envBool("REGISTRATION_CHECK_MX"); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range strings.Split(os.Getenv("REGISTRATION_DOMAIN_ROLES"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		pattern, role, ok := strings.Cut(entry, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		role = strings.TrimSpace(role)
+		if !ok || pattern == "" || !authz.Roles().Valid(role) {
+			return nil, fmt.Errorf("REGISTRATION_DOMAIN_ROLES inválido: %q", entry)
+		}
+		policy.DomainRoles = append(policy.DomainRoles, DomainRole{Pattern: pattern, Role: role})
+	}
+
+	return policy, nil
+}
+
+// Check valida que el correo pueda registrarse. Devuelve uno de los errores del paquete.
+func (p *Policy) Check(ctx context.Context, email string) error {
+	domain, err := Domain(email)
+	if err != nil {
+		return err
+	}
+
+	if len(p.Allow) > 0 && !matchAny(p.Allow, domain) {
+		return ErrDomainNotAllowed
+	}
+	if matchAny(p.Deny, domain) {
+		return ErrDomainDenied
+	}
+	if p.Disposable != nil && p.Disposable.Contains(domain) {
+		return ErrDisposable
+	}
+	if p.CheckMX && !p.receivesMail(ctx, domain) {
+		return ErrNoMailServer
+	}
+	return nil
+}
+
+// RoleFor devuelve el rol que recibe el correo al verificarse: el de su dominio en DomainRoles o el
+// rol de menor privilegio de la jerarquía
+func (p *Policy) RoleFor(email string) string {
+	if domain, err := Domain(email); err == nil {
+		for _, domainRole := range p.DomainRoles {
+			if match(domainRole.Pattern, domain) {
+				return domainRole.Role
+			}
+		}
+	}
+	return authz.Roles().Default()
+}
+
+// Domain valida la sintaxis del correo y devuelve su dominio en minúsculas
+func Domain(email string) (string, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != strings.TrimSpace(email) {
+		return "", ErrInvalidEmail
+	}
+	at := strings.LastIndex(address.Address, "@")
+	domain := strings.ToLower(address.Address[at+1:])
+	if !validDomain(domain) {
+		return "", ErrInvalidEmail
+	}
+	return domain, nil
+}
+
+// validDomain comprueba la sintaxis del dominio: al menos dos etiquetas de letras, dígitos y guiones
+func validDomain(domain string) bool {
+	if len(domain) > 253 {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// receivesMail indica si el dominio tiene registros MX o, según RFC 5321, una dirección donde entregar
+func (p *Policy) receivesMail(ctx context.Context, domain string) bool {
+	records, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// Un MX nulo (".", RFC 7505) indica que el dominio no acepta correo
+		return !(len(records) == 1 && records[0].Host == ".")
+	}
+	var dnsErr *net.DNSError
+	if err != nil && errors.As(err, &dnsErr) && !dnsErr.IsNotFound {
+		// Ante un error temporal del DNS no se rechaza el registro
+		return true
+	}
+	hosts, err := net.DefaultResolver.LookupHost(ctx, domain)
+	return err == nil && len(hosts) > 0
+}
+
+// match indica si el dominio coincide con el patrón
+func match(pattern, domain string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(domain, pattern[1:])
+	default:
+		return domain == pattern
+	}
+}
+
+func matchAny(patterns []string, domain string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func envBool(name string) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s inválido: %q", name, value)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,14 @@
+// api/email/config.go
+package email
+
+import "os"
+
+// SmtpConfigFromEnv construye la configuración SMTP a partir de las variables de entorno
+func SmtpConfigFromEnv() SmtpConfig {
+	return SmtpConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
@@ -1,6 +1,15 @@
 package httputil
 
 type ErrorResponse struct {
+	Message string       `json:"message"`
+	Code    string       `json:"code,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describe por qué no es válido un campo de la solicitud
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
@@ -0,0 +1,42 @@
+// auth/jobs.go
+
+package api
+
+import (
+	"context"
+	"time"
+
+	"backend/api/controllers"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"firebase.google.com/go/auth"
+)
+
+// StartBackgroundJobs inicia las tareas periódicas del servicio en segundo plano
+func StartBackgroundJobs(ctx context.Context, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	// Eliminar de forma permanente las cuentas cuyo plazo de restauración venció
+	go runEvery(ctx, time.Hour, func() {
+		controllers.PurgeExpiredAccountDeletions(ctx, firestoreClient, authClient, storageClient)
+	})
+
+	// Reintentar las eliminaciones de cuenta que quedaron incompletas
+	go runEvery(ctx, 15*time.Minute, func() {
+		controllers.ResumeFailedAccountDeletions(ctx, firestoreClient, authClient, storageClient)
+	})
+}
+
+// runEvery ejecuta fn cada intervalo hasta que se cancele el contexto
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
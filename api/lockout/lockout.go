@@ -0,0 +1,303 @@
+// api/lockout/lockout.go
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tipos de contador de intentos fallidos
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+)
+
+const (
+	// backoffBase es la espera después del primer intento fallido; se duplica con cada fallo siguiente
+	backoffBase = time.Second
+	// backoffMax limita la espera entre intentos
+	backoffMax = 30 * time.Second
+	// failureWindow es el tiempo sin fallos tras el cual el contador vuelve a cero
+	failureWindow = time.Hour
+	// maxLockDuration limita el bloqueo progresivo
+	maxLockDuration = 24 * time.Hour
+)
+
+// Config define cuándo se bloquea una cuenta o una IP
+type Config struct {
+	// MaxAccountFailures es la cantidad de fallos de una cuenta que provoca su bloqueo
+	MaxAccountFailures int
+	// MaxIPFailures es la cantidad de fallos desde una IP, en cualquier cuenta, que provoca su bloqueo
+	MaxIPFailures int
+	// LockDuration es la duración del primer bloqueo; cada bloqueo siguiente sin un inicio de sesión exitoso la duplica
+	LockDuration time.Duration
+}
+
+// ConfigFromEnv lee LOGIN_MAX_FAILURES (por defecto 5), LOGIN_MAX_IP_FAILURES (por defecto 50)
+// y LOGIN_LOCK_DURATION (por defecto 15m)
+func ConfigFromEnv() (Config, error) {
+	config := Config{MaxAccountFailures: 5, MaxIPFailures: 50, LockDuration: 15 * time.Minute}
+
+	for name, target := range map[string]*int{"LOGIN_MAX_FAILURES": &config.MaxAccountFailures, "LOGIN_MAX_IP_FAILURES": &config.MaxIPFailures} {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return config, fmt.Errorf("%s inválido: %q", name, value)
+		}
+		*target = n
+	}
+
+	if value := strings.TrimSpace(os.Getenv("LOGIN_LOCK_DURATION")); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("LOGIN_LOCK_DURATION inválido: %q", value)
+		}
+		config.LockDuration = d
+	}
+
+	return config, nil
+}
+
+// Attempts representa los intentos fallidos de una cuenta o IP, guardados en login_attempts/{kind}:{key}
+type Attempts struct {
+	Kind          string     `json:"kind" firestore:"kind"`
+	Key           string     `json:"key" firestore:"key"`
+	Failures      int        `json:"failures" firestore:"failures"`
+	Locks         int        `json:"locks" firestore:"locks"`
+	LastFailureAt time.Time  `json:"lastFailureAt" firestore:"lastFailureAt"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" firestore:"nextAttemptAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty" firestore:"lockedUntil"`
+	LastFailureIP string     `json:"lastFailureIp,omitempty" firestore:"lastFailureIp,omitempty"`
+}
+
+// Locked indica si el contador está bloqueado en el instante dado
+func (a *Attempts) Locked(now time.Time) bool {
+	return a.LockedUntil != nil && a.LockedUntil.After(now)
+}
+
+// Decision es el resultado de comprobar si se permite un intento de inicio de sesión
+type Decision struct {
+	Allowed bool
+	// Kind indica qué contador impidió el intento (KindAccount o KindIP)
+	Kind string
+	// Locked distingue un bloqueo de una espera por backoff
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+// Result describe el efecto de registrar un intento fallido
+type Result struct {
+	// AccountLocked indica que este fallo bloqueó la cuenta
+	AccountLocked bool
+	LockedUntil   time.Time
+	Failures      int
+}
+
+// Guard limita los intentos de inicio de sesión por cuenta y por IP. Como el estado se guarda en
+// Firestore, los bloqueos se comparten entre todas las réplicas.
+type Guard struct {
+	client *firestore.Client
+	config Config
+}
+
+// NewGuard crea un Guard con la configuración dada
+func NewGuard(client *firestore.Client, config Config) *Guard {
+	return &Guard{client: client, config: config}
+}
+
+// NewGuardFromEnv crea un Guard con la configuración de ConfigFromEnv
+func NewGuardFromEnv(client *firestore.Client) (*Guard, error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewGuard(client, config), nil
+}
+
+func (g *Guard) ref(kind, key string) *firestore.DocumentRef {
+	return g.client.Collection("login_attempts").Doc(kind + ":" + key)
+}
+
+// normalizeEmail evita que variaciones de mayúsculas esquiven el contador de la cuenta
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check indica si se permite un intento de inicio de sesión para la cuenta y la IP
+func (g *Guard) Check(ctx context.Context, email, ip string) (Decision, error) {
+	now := time.Now()
+	for _, counter := range []struct{ kind, key string }{{KindAccount, normalizeEmail(email)}, {KindIP, ip}} {
+		if counter.key == "" {
+			continue
+		}
+		attempts, err := g.get(ctx, g.ref(counter.kind, counter.key))
+		if err != nil {
+			return Decision{}, err
+		}
+		if attempts == nil {
+			continue
+		}
+		if attempts.Locked(now) {
+			return Decision{Kind: counter.kind, Locked: true, RetryAfter: attempts.LockedUntil.Sub(now)}, nil
+		}
+		if attempts.NextAttemptAt.After(now) {
+			return Decision{Kind: counter.kind, RetryAfter: attempts.NextAttemptAt.Sub(now)}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// RecordFailure suma un intento fallido a la cuenta y a la IP, calcula la espera hasta el siguiente
+// intento y bloquea los contadores que alcanzan su máximo.
+func (g *Guard) RecordFailure(ctx context.Context, email, ip string) (Result, error) {
+	var result Result
+	accountRef := g.ref(KindAccount, normalizeEmail(email))
+	ipRef := g.ref(KindIP, ip)
+
+	err := g.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		result = Result{}
+		now := time.Now()
+
+		account, err := g.getTx(tx, accountRef, KindAccount, normalizeEmail(email))
+		if err != nil {
+			return err
+		}
+		var ipAttempts *Attempts
+		if ip != "" {
+			if ipAttempts, err = g.getTx(tx, ipRef, KindIP, ip); err != nil {
+				return err
+			}
+		}
+
+		if g.fail(account, g.config.MaxAccountFailures, true, now) {
+			result.AccountLocked = true
+			result.LockedUntil = *account.LockedUntil
+		}
+		account.LastFailureIP = ip
+		result.Failures = account.Failures
+		if err := tx.Set(accountRef, account); err != nil {
+			return err
+		}
+
+		if ipAttempts != nil {
+			g.fail(ipAttempts, g.config.MaxIPFailures, false, now)
+			if err := tx.Set(ipRef, ipAttempts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("error al registrar el intento fallido: %v", err)
+	}
+	return result, nil
+}
+
+// RecordSuccess reinicia el contador de la cuenta tras un inicio de sesión exitoso. El contador de la
+// IP no se reinicia, para que una cuenta válida no sirva para seguir probando otras.
+func (g *Guard) RecordSuccess(ctx context.Context, email string) error {
+	_, err := g.ref(KindAccount, normalizeEmail(email)).Delete(ctx)
+	return err
+}
+
+// Unlock quita el bloqueo y los intentos fallidos de la cuenta
+func (g *Guard) Unlock(ctx context.Context, email string) error {
+	return g.RecordSuccess(ctx, email)
+}
+
+// Status devuelve los intentos fallidos de la cuenta, o nil si no tiene
+func (g *Guard) Status(ctx context.Context, email string) (*Attempts, error) {
+	return g.get(ctx, g.ref(KindAccount, normalizeEmail(email)))
+}
+
+// fail suma un fallo al contador y devuelve true si con él se bloquea. La espera exponencial solo se
+// aplica a las cuentas: una IP compartida (por ejemplo, la red de la universidad) solo se bloquea al
+// alcanzar su máximo.
+func (g *Guard) fail(attempts *Attempts, maxFailures int, withBackoff bool, now time.Time) bool {
+	// Los fallos antiguos y los bloqueos ya cumplidos no cuentan para el siguiente bloqueo
+	if now.Sub(attempts.LastFailureAt) > failureWindow || (attempts.LockedUntil != nil && !attempts.Locked(now)) {
+		attempts.Failures = 0
+		attempts.LockedUntil = nil
+	}
+
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	if withBackoff {
+		attempts.NextAttemptAt = now.Add(backoff(attempts.Failures))
+	}
+
+	if attempts.Failures < maxFailures {
+		return false
+	}
+
+	attempts.Locks++
+	until := now.Add(lockDuration(g.config.LockDuration, attempts.Locks))
+	attempts.LockedUntil = &until
+	attempts.NextAttemptAt = until
+	return true
+}
+
+// backoff calcula la espera tras el fallo número n: 1s, 2s, 4s... hasta backoffMax
+func backoff(failures int) time.Duration {
+	delay := backoffBase
+	for i := 1; i < failures && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > backoffMax {
+		return backoffMax
+	}
+	return delay
+}
+
+// lockDuration duplica la duración del bloqueo con cada bloqueo consecutivo, hasta maxLockDuration
+func lockDuration(base time.Duration, locks int) time.Duration {
+	duration := base
+	for i := 1; i < locks && duration < maxLockDuration; i++ {
+		duration *= 2
+	}
+	if duration > maxLockDuration {
+		return maxLockDuration
+	}
+	return duration
+}
+
+func (g *Guard) get(ctx context.Context, ref *firestore.DocumentRef) (*Attempts, error) {
+	doc, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener los intentos de inicio de sesión: %v", err)
+	}
+	var attempts Attempts
+	if err := doc.DataTo(&attempts); err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (g *Guard) getTx(tx *firestore.Transaction, ref *firestore.DocumentRef, kind, key string) (*Attempts, error) {
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return &Attempts{Kind: kind, Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var attempts Attempts
+	if err := doc.DataTo(&attempts); err != nil {
+		return nil, err
+	}
+	return &attempts, nil
+}
@@ -4,16 +4,38 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"backend/api/apikeys"
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"cloud.google.com/go/firestore"
 	"firebase.google.com/go/auth"
 	"github.com/gin-gonic/gin"
 )
 
 // AuthMiddleware verifica el token de autorización JWT y coloca el usuario en el contexto de Gin si el token es válido.
-func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
+//
+// Si el token es de suplantación (claim "act"), rechaza los vencidos y coloca al administrador en el
+// contexto como "actor" (*authz.Actor).
+//
+// También acepta personal access tokens, como "Authorization: Bearer pat_..." o en el encabezado X-API-Key.
+// En ese caso el usuario del contexto es un *auth.Token construido a partir de la cuenta, con los scopes de
+// la API key en el claim "scope" y su ID en el claim "api_key".
+func AuthMiddleware(authClient *auth.Client, firestoreClient *firestore.Client) gin.HandlerFunc {
+	keys := apikeys.NewStore(firestoreClient)
+
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, authClient, keys, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token de autorización no proporcionado"})
@@ -28,20 +50,134 @@ func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Verificar el token JWT
-		token, err := authClient.VerifyIDToken(context.Background(), idToken)
+		if apikeys.IsToken(idToken) {
+			authenticateAPIKey(c, authClient, keys, idToken)
+			return
+		}
+
+		// Verificar el token JWT y que las sesiones del usuario no hayan sido revocadas (p. ej. tras un cambio de rol)
+		token, err := authClient.VerifyIDTokenAndCheckRevoked(context.Background(), idToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token de autorización inválido"})
 			c.Abort()
 			return
 		}
 
-		// Colocar el usuario en el contexto
+		// En un token de suplantación, el administrador queda en el contexto como "actor"
+		if actor, ok := authz.ActorFromClaims(token.Claims); ok {
+			if actor.Expired(time.Now()) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "La suplantación expiró"})
+				c.Abort()
+				return
+			}
+			c.Set("actor", actor)
+		}
+
+		// Colocar el usuario y el token original en el contexto
 		c.Set("user", token)
+		c.Set("idToken", idToken)
+		c.Next()
+	}
+}
+
+// ErrCodeImpersonationNotAllowed es el código de error de las operaciones bloqueadas durante una suplantación
+const ErrCodeImpersonationNotAllowed = "impersonation_not_allowed"
+
+// BlockImpersonation rechaza la solicitud si proviene de un token de suplantación. Se usa en las
+// operaciones que solo el propio usuario debe poder realizar (contraseña, correo, credenciales, eliminación).
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, impersonating := c.Get("actor"); impersonating {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{
+				Message: "Esta operación no está disponible durante una suplantación",
+				Code:    ErrCodeImpersonationNotAllowed,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuthMiddleware se comporta como AuthMiddleware cuando la solicitud incluye el encabezado
+// Authorization o X-API-Key y deja pasar sin usuario en el contexto cuando no los incluye.
+func OptionalAuthMiddleware(authClient *auth.Client, firestoreClient *firestore.Client) gin.HandlerFunc {
+	required := AuthMiddleware(authClient, firestoreClient)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && c.GetHeader("X-API-Key") == "" {
+			c.Next()
+			return
+		}
+		required(c)
+	}
+}
+
+// RequireFirebaseSession rechaza las solicitudes autenticadas con una API key. Se usa en las rutas que
+// administran credenciales, para que una API key filtrada no pueda crear otras ni ampliar sus permisos.
+func RequireFirebaseSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isAPIKeyRequest(c) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "Esta operación no está disponible con una API key"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
+// isAPIKeyRequest indica si el usuario del contexto se autenticó con una API key
+func isAPIKeyRequest(c *gin.Context) bool {
+	user, ok := c.Get("user")
+	if !ok {
+		return false
+	}
+	_, isAPIKey := user.(*auth.Token).Claims[apikeys.Claim]
+	return isAPIKey
+}
+
+// authenticateAPIKey valida un personal access token y coloca en el contexto un token equivalente al de la cuenta.
+func authenticateAPIKey(c *gin.Context, authClient *auth.Client, keys *apikeys.Store, apiKey string) {
+	ctx := context.Background()
+
+	key, err := keys.Authenticate(ctx, apiKey)
+	if err != nil {
+		if !errors.Is(err, apikeys.ErrInvalidKey) {
+			log.Printf("Error al verificar la API key: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key inválida"})
+		c.Abort()
+		return
+	}
+
+	// Se consulta la cuenta en cada solicitud para respetar su rol actual y si está desactivada
+	user, err := authClient.GetUser(ctx, key.UID)
+	if err != nil || user.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key inválida"})
+		c.Abort()
+		return
+	}
+
+	claims := map[string]interface{}{}
+	for name, value := range user.CustomClaims {
+		claims[name] = value
+	}
+	claims["email"] = user.Email
+	claims["email_verified"] = user.EmailVerified
+	claims[authz.ScopeClaim] = strings.Join(key.Scopes, " ")
+	claims[apikeys.Claim] = key.ID
+
+	now := time.Now()
+	c.Set("user", &auth.Token{
+		UID:      user.UID,
+		Subject:  user.UID,
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(time.Hour).Unix(),
+		Firebase: auth.FirebaseInfo{SignInProvider: "api_key"},
+		Claims:   claims,
+	})
+	c.Next()
+}
+
 // Función para extraer el token de autorización del encabezado
 func extractTokenFromHeader(header string) string {
 	parts := strings.Split(header, " ")
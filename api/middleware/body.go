@@ -0,0 +1,22 @@
+// middleware/body.go
+
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekBodyBytes es el tamaño máximo del cuerpo que leen los middlewares antes del controlador
+const maxPeekBodyBytes = 1 << 20
+
+// peekBody lee el cuerpo de la solicitud, hasta maxPeekBodyBytes, y lo restaura para que el controlador
+// lo pueda leer. Un cuerpo más grande devuelve error.
+func peekBody(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPeekBodyBytes))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
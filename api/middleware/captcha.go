@@ -0,0 +1,75 @@
+// middleware/captcha.go
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/api/captcha"
+	"backend/api/httputil"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Códigos de error del CAPTCHA
+const (
+	ErrCodeCaptchaRequired    = "captcha_required"
+	ErrCodeCaptchaInvalid     = "captcha_invalid"
+	ErrCodeCaptchaUnavailable = "captcha_unavailable"
+)
+
+// CaptchaHeader es el encabezado con el token del CAPTCHA; también se acepta el campo captchaToken del cuerpo JSON
+const CaptchaHeader = "X-Captcha-Token"
+
+// Captcha exige un token de CAPTCHA válido antes de ejecutar el controlador. Si verifier es nil (CAPTCHA
+// desactivado) la solicitud continúa sin verificar. Si el proveedor no responde, la solicitud se rechaza.
+func Captcha(verifier captcha.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if verifier == nil {
+			c.Next()
+			return
+		}
+
+		err := verifier.Verify(context.Background(), captchaToken(c), c.ClientIP())
+		switch {
+		case err == nil:
+			c.Next()
+			return
+		case errors.Is(err, captcha.ErrMissingToken):
+			c.JSON(http.StatusBadRequest, httputil.ErrorResponse{Message: "Se requiere completar el CAPTCHA", Code: ErrCodeCaptchaRequired})
+		case errors.Is(err, captcha.ErrInvalidToken):
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "El CAPTCHA no es válido o expiró", Code: ErrCodeCaptchaInvalid})
+		default:
+			log.Printf("Error al verificar el CAPTCHA: %v", err)
+			c.JSON(http.StatusServiceUnavailable, httputil.ErrorResponse{Message: "No se pudo verificar el CAPTCHA. Inténtalo de nuevo.", Code: ErrCodeCaptchaUnavailable})
+		}
+		c.Abort()
+	}
+}
+
+// captchaToken obtiene el token del encabezado o del campo captchaToken del cuerpo JSON, restaurando el
+// cuerpo para que el controlador lo pueda leer
+func captchaToken(c *gin.Context) string {
+	if token := c.GetHeader(CaptchaHeader); token != "" {
+		return token
+	}
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := peekBody(c)
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		CaptchaToken string `json:"captchaToken"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return payload.CaptchaToken
+}
@@ -0,0 +1,51 @@
+// middleware/orgs.go
+
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"backend/api/httputil"
+	"backend/api/orgs"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireOrgMember exige que el usuario colocado por AuthMiddleware sea miembro de la organización del
+// parámetro :orgId con al menos el rol indicado (member < admin < owner). La membresía se consulta en el
+// Store y no en el claim "org", que puede estar desactualizado. La membresía queda en el contexto como "orgMember".
+func RequireOrgMember(store orgs.Store, minRole string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+			c.Abort()
+			return
+		}
+
+		member, err := store.Member(c, c.Param("orgId"), user.(*auth.Token).UID)
+		if errors.Is(err, orgs.ErrNotMember) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No perteneces a esta organización"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			log.Printf("Error al verificar la membresía en la organización %s: %v", c.Param("orgId"), err)
+			c.JSON(http.StatusInternalServerError, httputil.ErrorResponse{Message: "Error interno del servidor"})
+			c.Abort()
+			return
+		}
+
+		if !orgs.Roles.AtLeast(member.Role, minRole) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes permisos para realizar esta acción"})
+			c.Abort()
+			return
+		}
+
+		c.Set("orgMember", member)
+		c.Next()
+	}
+}
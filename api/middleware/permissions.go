@@ -0,0 +1,34 @@
+// middleware/permissions.go
+
+package middleware
+
+import (
+	"net/http"
+
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission exige que el token colocado por AuthMiddleware conceda el permiso indicado: el rol
+// del usuario debe incluirlo (ver ROLE_PERMISSIONS) y, si el token tiene el claim "scope", también el scope.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+			c.Abort()
+			return
+		}
+
+		if !authz.Permissions().Has(user.(*auth.Token).Claims, perm) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes permisos para realizar esta acción"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
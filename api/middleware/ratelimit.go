@@ -0,0 +1,132 @@
+// middleware/ratelimit.go
+
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/api/httputil"
+	"backend/api/ratelimit"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCodeRateLimited indica que se superó el límite de solicitudes de la ruta
+const ErrCodeRateLimited = "rate_limited"
+
+// RateLimitKey obtiene la clave por la que se cuenta una solicitud. Una clave vacía hace que se cuente por IP.
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIP cuenta las solicitudes por IP del cliente
+func RateLimitByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// RateLimitByUID cuenta las solicitudes por el usuario autenticado; requiere AuthMiddleware antes
+func RateLimitByUID(c *gin.Context) string {
+	if user, ok := c.Get("user"); ok {
+		return user.(*auth.Token).UID
+	}
+	return ""
+}
+
+// RateLimitByBodyField cuenta las solicitudes por un campo de texto del cuerpo JSON (por ejemplo "email").
+// Si se indican varios campos se usa el primero que venga con valor. El cuerpo se restaura para que el
+// controlador lo pueda leer.
+func RateLimitByBodyField(fields ...string) RateLimitKey {
+	return func(c *gin.Context) string {
+		payload := bodyPayload(c)
+		for _, field := range fields {
+			if value, _ := payload[field].(string); strings.TrimSpace(value) != "" {
+				return field + ":" + strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+		return ""
+	}
+}
+
+// RateLimitByAccount cuenta las solicitudes por la cuenta que indica el cuerpo JSON con su uid o su correo.
+// El correo se traduce al uid de la cuenta, para que alternar entre ambos campos no duplique el límite; un
+// correo sin cuenta se cuenta por sí mismo.
+func RateLimitByAccount(authClient *auth.Client, uidField, emailField string) RateLimitKey {
+	return func(c *gin.Context) string {
+		payload := bodyPayload(c)
+		if uid, _ := payload[uidField].(string); strings.TrimSpace(uid) != "" {
+			return "uid:" + strings.TrimSpace(uid)
+		}
+		email, _ := payload[emailField].(string)
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			return ""
+		}
+		if user, err := authClient.GetUserByEmail(context.Background(), email); err == nil {
+			return "uid:" + user.UID
+		}
+		return "email:" + email
+	}
+}
+
+// bodyPayload devuelve el cuerpo JSON de la solicitud como mapa, o nil si no es un objeto JSON
+func bodyPayload(c *gin.Context) map[string]interface{} {
+	if c.Request.Body == nil {
+		return nil
+	}
+	body, err := peekBody(c)
+	if err != nil {
+		return nil
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil
+	}
+	return payload
+}
+
+// RateLimit limita las solicitudes de una ruta según la clave indicada. name distingue los contadores de
+// cada regla, de modo que una misma clave tenga límites independientes en cada ruta. Responde 429 con
+// Retry-After al superar el límite y agrega siempre los encabezados RateLimit-Limit, RateLimit-Remaining
+// y RateLimit-Reset. Si el store falla, la solicitud se permite.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := key(c)
+		if value == "" {
+			value = "ip:" + c.ClientIP()
+		}
+
+		result, err := store.Allow(context.Background(), name+":"+value, limit)
+		if err != nil {
+			log.Printf("Error en el rate limit %s: %v", name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, httputil.ErrorResponse{
+				Message: "Demasiadas solicitudes. Inténtalo de nuevo más tarde.",
+				Code:    ErrCodeRateLimited,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ceilSeconds redondea hacia arriba para no indicar un reintento antes de tiempo
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,88 @@
+// middleware/recent_auth.go
+
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/api/httputil"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrCodeReauthenticationRequired es el código de error que se devuelve cuando la operación exige re-autenticación
+const ErrCodeReauthenticationRequired = "reauthentication_required"
+
+// ReauthSessionField guarda en users/{uid} el auth_time de la sesión que hizo la última re-autenticación
+const ReauthSessionField = "authTimeSession"
+
+// RequireRecentAuth exige que el usuario haya demostrado su contraseña en los últimos maxAge.
+//
+// Debe usarse después de AuthMiddleware. Se considera como momento de autenticación el más reciente entre
+// el auth_time del ID token de Firebase y el authTime registrado por POST /reauthenticate en users/{uid},
+// que solo vale para la sesión que se re-autenticó (la del mismo auth_time). Las API keys y los tokens de
+// suplantación nunca cumplen el requisito, ya que no prueban que el usuario conozca su contraseña.
+func RequireRecentAuth(firestoreClient *firestore.Client, maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+			c.Abort()
+			return
+		}
+		token := user.(*auth.Token)
+
+		if _, impersonating := c.Get("actor"); impersonating {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{
+				Message: "Esta operación no está disponible durante una suplantación",
+				Code:    ErrCodeImpersonationNotAllowed,
+			})
+			c.Abort()
+			return
+		}
+		if isAPIKeyRequest(c) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "Esta operación no está disponible con una API key"})
+			c.Abort()
+			return
+		}
+
+		authTime := time.Unix(token.AuthTime, 0)
+		if recorded, err := recordedAuthTime(firestoreClient, token); err != nil {
+			log.Printf("Error al obtener authTime del usuario %s: %v", token.UID, err)
+		} else if recorded.After(authTime) {
+			authTime = recorded
+		}
+
+		if time.Since(authTime) > maxAge {
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{
+				Message: "Esta operación requiere volver a autenticarse",
+				Code:    ErrCodeReauthenticationRequired,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// recordedAuthTime obtiene el authTime guardado en Firestore por la última re-autenticación, si se hizo
+// desde la misma sesión que el token. Las sesiones se distinguen por el auth_time de su inicio de sesión,
+// que Firebase conserva al renovar el ID token.
+func recordedAuthTime(firestoreClient *firestore.Client, token *auth.Token) (time.Time, error) {
+	doc, err := firestoreClient.Collection("users").Doc(token.UID).Get(context.Background())
+	if err != nil {
+		return time.Time{}, err
+	}
+	data := doc.Data()
+	if session, _ := data[ReauthSessionField].(int64); session != token.AuthTime {
+		return time.Time{}, nil
+	}
+	authTime, _ := data["authTime"].(time.Time)
+	return authTime, nil
+}
@@ -0,0 +1,41 @@
+// middleware/roles.go
+
+package middleware
+
+import (
+	"net/http"
+
+	"backend/api/authz"
+	"backend/api/httputil"
+
+	"firebase.google.com/go/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole exige que el custom claim "role" del token colocado por AuthMiddleware sea el rol indicado
+// o uno superior según la jerarquía configurada (member < staff < admin por defecto).
+func RequireRole(role string) gin.HandlerFunc {
+	return requireRoleMatching(func(userRole string) bool {
+		return authz.Roles().AtLeast(userRole, role)
+	})
+}
+
+// requireRoleMatching construye un middleware que deja pasar solo a los usuarios cuyo rol cumple allowed.
+func requireRoleMatching(allowed func(userRole string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := c.Get("user")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, httputil.ErrorResponse{Message: "No autorizado"})
+			c.Abort()
+			return
+		}
+
+		if userRole, _ := user.(*auth.Token).Claims["role"].(string); !allowed(userRole) {
+			c.JSON(http.StatusForbidden, httputil.ErrorResponse{Message: "No tienes permisos para realizar esta acción"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
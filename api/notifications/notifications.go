@@ -0,0 +1,271 @@
+// api/notifications/notifications.go
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+
+	emailPkg "backend/api/email"
+	"backend/api/utils"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Event identifica un tipo de notificación de seguridad
+type Event string
+
+// Eventos que generan una notificación por correo
+const (
+	EventNewLogin          Event = "new_login"
+	EventPasswordChanged   Event = "password_changed"
+	EventEmailChanged      Event = "email_changed"
+	EventPhotoChanged      Event = "photo_changed"
+	EventTwoFactorEnabled  Event = "two_factor_enabled"
+	EventTwoFactorDisabled Event = "two_factor_disabled"
+	EventAccountLocked     Event = "account_locked"
+)
+
+// Events enumera los eventos en el orden en que se muestran las preferencias
+var Events = []Event{
+	EventNewLogin,
+	EventPasswordChanged,
+	EventEmailChanged,
+	EventPhotoChanged,
+	EventTwoFactorEnabled,
+	EventTwoFactorDisabled,
+	EventAccountLocked,
+}
+
+// LockLinkTTL es la vigencia del enlace "no fui yo" incluido en cada notificación
+const LockLinkTTL = 7 * 24 * time.Hour
+
+// preferencesField es el campo de users/{uid} donde se guardan las preferencias
+const preferencesField = "notificationPreferences"
+
+var (
+	ErrUnknownEvent = errors.New("evento de notificación desconocido")
+	ErrMandatory    = errors.New("la notificación es obligatoria y no se puede desactivar")
+)
+
+// definition describe cómo se envía la notificación de un evento
+type definition struct {
+	subject  string
+	template *template.Template
+	// mandatory indica que el usuario no puede desactivar la notificación
+	mandatory bool
+}
+
+var definitions map[Event]definition
+
+func init() {
+	definitions = map[Event]definition{
+		EventNewLogin:          {"Nuevo inicio de sesión en tu cuenta", template.Must(template.ParseFiles("html/new_login.html")), false},
+		EventPasswordChanged:   {"Tu contraseña fue cambiada", template.Must(template.ParseFiles("html/password_changed.html")), true},
+		EventEmailChanged:      {"Tu correo fue cambiado", template.Must(template.ParseFiles("html/email_changed.html")), true},
+		EventPhotoChanged:      {"Tu foto de perfil fue cambiada", template.Must(template.ParseFiles("html/photo_changed.html")), false},
+		EventTwoFactorEnabled:  {"Verificación en dos pasos activada", template.Must(template.ParseFiles("html/two_factor_enabled.html")), true},
+		EventTwoFactorDisabled: {"Verificación en dos pasos desactivada", template.Must(template.ParseFiles("html/two_factor_disabled.html")), true},
+		EventAccountLocked:     {"Tu cuenta fue bloqueada temporalmente", template.Must(template.ParseFiles("html/account_locked.html")), true},
+	}
+}
+
+// Known indica si el evento existe
+func Known(event Event) bool {
+	_, ok := definitions[event]
+	return ok
+}
+
+// Mandatory indica si la notificación del evento se envía siempre, sin importar las preferencias
+func Mandatory(event Event) bool {
+	return definitions[event].mandatory
+}
+
+// Details contiene los datos del evento que se muestran en el correo
+type Details struct {
+	IP        string
+	UserAgent string
+	Time      time.Time
+	OldEmail  string
+	NewEmail  string
+	UndoLink  string
+	// LockedUntil es el fin del bloqueo temporal por intentos fallidos
+	LockedUntil time.Time
+}
+
+// Preference representa si el usuario recibe la notificación de un evento
+type Preference struct {
+	Event     Event `json:"event"`
+	Enabled   bool  `json:"enabled"`
+	Mandatory bool  `json:"mandatory"`
+}
+
+// Notifier envía las notificaciones de seguridad respetando las preferencias del usuario
+type Notifier struct {
+	firestoreClient *firestore.Client
+}
+
+// NewNotifier crea un Notifier que lee las preferencias y dispositivos desde Firestore
+func NewNotifier(firestoreClient *firestore.Client) *Notifier {
+	return &Notifier{firestoreClient: firestoreClient}
+}
+
+// Preferences devuelve las preferencias del usuario para todos los eventos. Por defecto todas están activas.
+func (n *Notifier) Preferences(ctx context.Context, uid string) ([]Preference, error) {
+	stored, err := n.storedPreferences(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs := make([]Preference, 0, len(Events))
+	for _, event := range Events {
+		enabled, ok := stored[string(event)].(bool)
+		prefs = append(prefs, Preference{
+			Event:     event,
+			Enabled:   Mandatory(event) || !ok || enabled,
+			Mandatory: Mandatory(event),
+		})
+	}
+	return prefs, nil
+}
+
+// SetPreferences actualiza las preferencias indicadas. Las notificaciones obligatorias no se pueden desactivar.
+func (n *Notifier) SetPreferences(ctx context.Context, uid string, updates map[Event]bool) error {
+	values := make(map[string]interface{}, len(updates))
+	for event, enabled := range updates {
+		if !Known(event) {
+			return fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+		}
+		if Mandatory(event) && !enabled {
+			return fmt.Errorf("%w: %s", ErrMandatory, event)
+		}
+		values[string(event)] = enabled
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	_, err := n.firestoreClient.Collection("users").Doc(uid).Set(ctx, map[string]interface{}{
+		preferencesField: values,
+	}, firestore.MergeAll)
+	return err
+}
+
+// Notify envía la notificación del evento a la dirección indicada, salvo que el usuario la haya desactivado.
+// Cada correo incluye un enlace "no fui yo" que bloquea la cuenta e inicia el restablecimiento de la contraseña.
+func (n *Notifier) Notify(ctx context.Context, uid, to string, event Event, details Details) error {
+	def, ok := definitions[event]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEvent, event)
+	}
+	if to == "" {
+		return nil
+	}
+
+	if !def.mandatory {
+		stored, err := n.storedPreferences(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if enabled, ok := stored[string(event)].(bool); ok && !enabled {
+			return nil
+		}
+	}
+
+	lockToken, err := utils.GenerarTokenConProposito(to, uid, utils.PurposeAccountLock, "", LockLinkTTL)
+	if err != nil {
+		return fmt.Errorf("error al generar el enlace de bloqueo: %v", err)
+	}
+
+	if details.Time.IsZero() {
+		details.Time = time.Now()
+	}
+	data := struct {
+		Details
+		Email    string
+		LockLink string
+		Year     int
+	}{
+		Details:  details,
+		Email:    to,
+		LockLink: fmt.Sprintf("%s/lock-account?token=%s", os.Getenv("URL_FRONTEND"), lockToken),
+		Year:     time.Now().Year(),
+	}
+
+	var body bytes.Buffer
+	if err := def.template.Execute(&body, data); err != nil {
+		return fmt.Errorf("error al ejecutar el template HTML: %v", err)
+	}
+	if err := emailPkg.SendMail(emailPkg.SmtpConfigFromEnv(), to, def.subject, body.String()); err != nil {
+		return fmt.Errorf("error al enviar el correo: %v", err)
+	}
+	return nil
+}
+
+// NotifyLogin registra el dispositivo del inicio de sesión en users/{uid}/devices y, si es la primera vez
+// que se ve esa combinación de IP y navegador, envía la notificación de nuevo inicio de sesión. El primer
+// dispositivo de una cuenta no genera notificación.
+func (n *Notifier) NotifyLogin(ctx context.Context, uid, to, ip, userAgent string) error {
+	devices := n.firestoreClient.Collection("users").Doc(uid).Collection("devices")
+	ref := devices.Doc(deviceID(ip, userAgent))
+	now := time.Now()
+
+	_, err := ref.Get(ctx)
+	if err == nil {
+		_, err = ref.Update(ctx, []firestore.Update{{Path: "lastSeenAt", Value: now}})
+		return err
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	_, err = devices.Limit(1).Documents(ctx).Next()
+	firstDevice := err == iterator.Done
+	if err != nil && !firstDevice {
+		return err
+	}
+
+	_, err = ref.Set(ctx, map[string]interface{}{
+		"ip":          ip,
+		"userAgent":   userAgent,
+		"firstSeenAt": now,
+		"lastSeenAt":  now,
+	})
+	if err != nil {
+		return err
+	}
+
+	if firstDevice {
+		return nil
+	}
+	return n.Notify(ctx, uid, to, EventNewLogin, Details{IP: ip, UserAgent: userAgent, Time: now})
+}
+
+// storedPreferences lee las preferencias guardadas en el perfil del usuario
+func (n *Notifier) storedPreferences(ctx context.Context, uid string) (map[string]interface{}, error) {
+	doc, err := n.firestoreClient.Collection("users").Doc(uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener las preferencias de notificación: %v", err)
+	}
+
+	stored, _ := doc.Data()[preferencesField].(map[string]interface{})
+	return stored, nil
+}
+
+// deviceID identifica un dispositivo por la combinación de IP y navegador, sin guardarla en el ID
+func deviceID(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:16])
+}
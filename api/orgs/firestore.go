@@ -0,0 +1,182 @@
+// api/orgs/firestore.go
+package orgs
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FirestoreStore guarda las organizaciones en organizations/{orgId} y sus miembros en
+// organizations/{orgId}/members/{uid}. Cada membresía se replica en users/{uid}/organizations/{orgId}
+// para listar las organizaciones de un usuario sin consultas de grupo de colecciones.
+type FirestoreStore struct {
+	client *firestore.Client
+}
+
+// NewFirestoreStore crea un Store respaldado por documentos de Firestore
+func NewFirestoreStore(client *firestore.Client) *FirestoreStore {
+	return &FirestoreStore{client: client}
+}
+
+func (s *FirestoreStore) orgRef(orgID string) *firestore.DocumentRef {
+	return s.client.Collection("organizations").Doc(orgID)
+}
+
+func (s *FirestoreStore) memberRef(orgID, uid string) *firestore.DocumentRef {
+	return s.orgRef(orgID).Collection("members").Doc(uid)
+}
+
+func (s *FirestoreStore) membershipRef(orgID, uid string) *firestore.DocumentRef {
+	return s.client.Collection("users").Doc(uid).Collection("organizations").Doc(orgID)
+}
+
+// Create crea la organización con ownerUID como propietario
+func (s *FirestoreStore) Create(ctx context.Context, name, ownerUID string) (*Organization, error) {
+	return s.create(ctx, s.client.Collection("organizations").NewDoc().ID, name, "", ownerUID)
+}
+
+// create guarda la organización y la membresía del propietario en un solo batch
+func (s *FirestoreStore) create(ctx context.Context, orgID, name, tenantID, ownerUID string) (*Organization, error) {
+	now := time.Now()
+	org := &Organization{ID: orgID, Name: name, TenantID: tenantID, CreatedBy: ownerUID, CreatedAt: now}
+	owner := Member{Role: RoleOwner, JoinedAt: now}
+
+	batch := s.client.Batch()
+	batch.Create(s.orgRef(orgID), org)
+	batch.Set(s.memberRef(orgID, ownerUID), owner)
+	batch.Set(s.membershipRef(orgID, ownerUID), owner)
+	if _, err := batch.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// Get devuelve la organización o ErrNotFound
+func (s *FirestoreStore) Get(ctx context.Context, orgID string) (*Organization, error) {
+	doc, err := s.orgRef(orgID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var org Organization
+	if err := doc.DataTo(&org); err != nil {
+		return nil, err
+	}
+	org.ID = doc.Ref.ID
+	return &org, nil
+}
+
+// SetMember agrega al usuario a la organización o cambia su rol, conservando la fecha de ingreso
+func (s *FirestoreStore) SetMember(ctx context.Context, orgID, uid, role string) (*Member, error) {
+	member := &Member{OrgID: orgID, UID: uid, Role: role}
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if _, err := tx.Get(s.orgRef(orgID)); err != nil {
+			if status.Code(err) == codes.NotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		member.JoinedAt = time.Now()
+		doc, err := tx.Get(s.memberRef(orgID, uid))
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if joinedAt, ok := doc.Data()["joinedAt"].(time.Time); ok {
+				member.JoinedAt = joinedAt
+			}
+		}
+
+		if err := tx.Set(s.memberRef(orgID, uid), member); err != nil {
+			return err
+		}
+		return tx.Set(s.membershipRef(orgID, uid), member)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// RemoveMember quita al usuario de la organización
+func (s *FirestoreStore) RemoveMember(ctx context.Context, orgID, uid string) error {
+	batch := s.client.Batch()
+	batch.Delete(s.memberRef(orgID, uid))
+	batch.Delete(s.membershipRef(orgID, uid))
+	_, err := batch.Commit(ctx)
+	return err
+}
+
+// Member devuelve la membresía del usuario o ErrNotMember
+func (s *FirestoreStore) Member(ctx context.Context, orgID, uid string) (*Member, error) {
+	doc, err := s.memberRef(orgID, uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return memberFromDoc(orgID, uid, doc)
+}
+
+// Members lista los miembros de la organización
+func (s *FirestoreStore) Members(ctx context.Context, orgID string) ([]Member, error) {
+	members := []Member{}
+	it := s.orgRef(orgID).Collection("members").Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return members, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		member, err := memberFromDoc(orgID, doc.Ref.ID, doc)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+}
+
+// UserMemberships lista las organizaciones del usuario a partir de users/{uid}/organizations
+func (s *FirestoreStore) UserMemberships(ctx context.Context, uid string) ([]Member, error) {
+	memberships := []Member{}
+	it := s.client.Collection("users").Doc(uid).Collection("organizations").Documents(ctx)
+	defer it.Stop()
+	for {
+		doc, err := it.Next()
+		if err == iterator.Done {
+			return memberships, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		member, err := memberFromDoc(doc.Ref.ID, uid, doc)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, *member)
+	}
+}
+
+func memberFromDoc(orgID, uid string, doc *firestore.DocumentSnapshot) (*Member, error) {
+	var member Member
+	if err := doc.DataTo(&member); err != nil {
+		return nil, err
+	}
+	member.OrgID = orgID
+	member.UID = uid
+	return &member, nil
+}
@@ -0,0 +1,83 @@
+// api/orgs/orgs.go
+package orgs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"backend/api/authz"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+)
+
+// Roles dentro de una organización, de menor a mayor privilegio
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+// Roles es la jerarquía de roles de las organizaciones
+var Roles = authz.NewRoleHierarchy(RoleMember, RoleAdmin, RoleOwner)
+
+// Backends disponibles en ORG_BACKEND
+const (
+	BackendFirestore = "firestore"
+	BackendTenant    = "tenant"
+)
+
+var (
+	// ErrNotFound indica que la organización no existe
+	ErrNotFound = errors.New("organización no encontrada")
+	// ErrNotMember indica que el usuario no es miembro de la organización
+	ErrNotMember = errors.New("el usuario no es miembro de la organización")
+)
+
+// Organization representa una organización (por ejemplo, una facultad)
+type Organization struct {
+	ID        string    `json:"id" firestore:"-"`
+	Name      string    `json:"name" firestore:"name"`
+	TenantID  string    `json:"tenantId,omitempty" firestore:"tenantId,omitempty"`
+	CreatedBy string    `json:"createdBy" firestore:"createdBy"`
+	CreatedAt time.Time `json:"createdAt" firestore:"createdAt"`
+}
+
+// Member representa la membresía de un usuario en una organización
+type Member struct {
+	OrgID    string    `json:"orgId" firestore:"-"`
+	UID      string    `json:"uid" firestore:"-"`
+	Role     string    `json:"role" firestore:"role"`
+	JoinedAt time.Time `json:"joinedAt" firestore:"joinedAt"`
+}
+
+// Store administra las organizaciones y sus miembros
+type Store interface {
+	// Create crea la organización con ownerUID como propietario
+	Create(ctx context.Context, name, ownerUID string) (*Organization, error)
+	Get(ctx context.Context, orgID string) (*Organization, error)
+	// SetMember agrega al usuario a la organización o cambia su rol
+	SetMember(ctx context.Context, orgID, uid, role string) (*Member, error)
+	RemoveMember(ctx context.Context, orgID, uid string) error
+	// Member devuelve ErrNotMember si el usuario no pertenece a la organización
+	Member(ctx context.Context, orgID, uid string) (*Member, error)
+	Members(ctx context.Context, orgID string) ([]Member, error)
+	// UserMemberships devuelve las organizaciones a las que pertenece el usuario
+	UserMemberships(ctx context.Context, uid string) ([]Member, error)
+}
+
+// NewStoreFromEnv crea el Store configurado en ORG_BACKEND ("firestore" por defecto o "tenant")
+func NewStoreFromEnv(firestoreClient *firestore.Client, authClient *auth.Client) (Store, error) {
+	backend := strings.TrimSpace(os.Getenv("ORG_BACKEND"))
+	switch backend {
+	case "", BackendFirestore:
+		return NewFirestoreStore(firestoreClient), nil
+	case BackendTenant:
+		return NewTenantStore(firestoreClient, authClient), nil
+	}
+	return nil, fmt.Errorf("ORG_BACKEND inválido: %q", backend)
+}
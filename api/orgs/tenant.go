@@ -0,0 +1,68 @@
+// api/orgs/tenant.go
+package orgs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/auth"
+)
+
+// TenantStore crea un tenant de Firebase Authentication (Identity Platform) por cada organización, para
+// que las aplicaciones de la organización autentiquen a sus usuarios de forma aislada. El tenant se usa
+// como identificador de la organización; los datos y las membresías de las cuentas de este servicio se
+// siguen guardando en Firestore.
+type TenantStore struct {
+	*FirestoreStore
+	authClient *auth.Client
+}
+
+// NewTenantStore crea un Store respaldado por tenants de Firebase Authentication
+func NewTenantStore(firestoreClient *firestore.Client, authClient *auth.Client) *TenantStore {
+	return &TenantStore{FirestoreStore: NewFirestoreStore(firestoreClient), authClient: authClient}
+}
+
+// Create crea el tenant y la organización con el mismo identificador
+func (s *TenantStore) Create(ctx context.Context, name, ownerUID string) (*Organization, error) {
+	tenant, err := s.authClient.TenantManager.CreateTenant(ctx, (&auth.TenantToCreate{}).
+		DisplayName(tenantDisplayName(name)).
+		AllowPasswordSignUp(true))
+	if err != nil {
+		return nil, fmt.Errorf("error al crear el tenant: %v", err)
+	}
+
+	org, err := s.create(ctx, tenant.ID, name, tenant.ID, ownerUID)
+	if err != nil {
+		if delErr := s.authClient.TenantManager.DeleteTenant(ctx, tenant.ID); delErr != nil {
+			log.Printf("Error al eliminar el tenant %s tras un fallo: %v", tenant.ID, delErr)
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+var tenantNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// tenantDisplayName adapta el nombre a las reglas de Firebase: de 4 a 20 caracteres, letras, dígitos y
+// guiones, comenzando con una letra.
+func tenantDisplayName(name string) string {
+	display := strings.Trim(tenantNameInvalidChars.ReplaceAllString(name, "-"), "-")
+	if display == "" || !isLetter(display[0]) {
+		display = "org-" + display
+	}
+	if len(display) > 20 {
+		display = strings.TrimRight(display[:20], "-")
+	}
+	for len(display) < 4 {
+		display += "-org"
+	}
+	return display
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,221 @@
+// api/passwordhistory/passwordhistory.go
+package passwordhistory
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"golang.org/x/crypto/argon2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Campos de users/{uid} donde se guarda el historial
+const (
+	FieldHistory   = "passwordHistory"
+	FieldChangedAt = "passwordChangedAt"
+)
+
+// Parámetros de Argon2id (recomendación de OWASP: 19 MiB, 2 iteraciones, 1 hilo)
+const (
+	argonTime    = 2
+	argonMemory  = 19 * 1024
+	argonThreads = 1
+	argonKeyLen  = 32
+	saltLength   = 16
+)
+
+// Entry es una contraseña anterior, guardada como hash Argon2id con su propia sal
+type Entry struct {
+	Hash      string    `firestore:"hash"`
+	Salt      string    `firestore:"salt"`
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+// matches compara en tiempo constante la contraseña con la entrada
+func (e Entry) matches(password string) bool {
+	salt, err := base64.RawStdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return false
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(e.Hash)
+	if err != nil {
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return subtle.ConstantTimeCompare(hash, candidate) == 1
+}
+
+// newEntry calcula el hash de la contraseña con una sal aleatoria
+func newEntry(password string, now time.Time) (Entry, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return Entry{}, err
+	}
+	hash := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return Entry{
+		Hash:      base64.RawStdEncoding.EncodeToString(hash),
+		Salt:      base64.RawStdEncoding.EncodeToString(salt),
+		CreatedAt: now,
+	}, nil
+}
+
+// Store guarda las últimas contraseñas de cada usuario en users/{uid} para impedir que se reutilicen
+type Store struct {
+	client *firestore.Client
+	// Size es la cantidad de contraseñas anteriores que no se pueden reutilizar; 0 desactiva el historial
+	Size int
+	// MaxAge es la antigüedad máxima de la contraseña; 0 la desactiva
+	MaxAge time.Duration
+}
+
+// NewStoreFromEnv crea el Store con PASSWORD_HISTORY_SIZE (por defecto 5) y PASSWORD_MAX_AGE (por ejemplo
+// "90d" o "2160h"; vacío la desactiva)
+func NewStoreFromEnv(client *firestore.Client) (*Store, error) {
+	store := &Store{client: client, Size: 5}
+
+	if value := strings.TrimSpace(os.Getenv("PASSWORD_HISTORY_SIZE")); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("PASSWORD_HISTORY_SIZE inválido: %q", value)
+		}
+		store.Size = n
+	}
+
+	if value := strings.TrimSpace(os.Getenv("PASSWORD_MAX_AGE")); value != "" {
+		maxAge, err := parseAge(value)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("PASSWORD_MAX_AGE inválido: %q", value)
+		}
+		store.MaxAge = maxAge
+	}
+
+	return store, nil
+}
+
+// parseAge acepta las duraciones de Go y además días ("90d")
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func (s *Store) ref(uid string) *firestore.DocumentRef {
+	return s.client.Collection("users").Doc(uid)
+}
+
+// entries lee el historial guardado en el documento
+func entries(data map[string]interface{}) []Entry {
+	raw, _ := data[FieldHistory].([]interface{})
+	history := make([]Entry, 0, len(raw))
+	for _, item := range raw {
+		values, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := Entry{}
+		entry.Hash, _ = values["hash"].(string)
+		entry.Salt, _ = values["salt"].(string)
+		entry.CreatedAt, _ = values["createdAt"].(time.Time)
+		history = append(history, entry)
+	}
+	return history
+}
+
+func (s *Store) load(ctx context.Context, uid string) (map[string]interface{}, error) {
+	doc, err := s.ref(uid).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return map[string]interface{}{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al obtener el historial de contraseñas: %v", err)
+	}
+	return doc.Data(), nil
+}
+
+// Reused indica si la contraseña coincide con alguna de las últimas Size contraseñas del usuario
+func (s *Store) Reused(ctx context.Context, uid, password string) (bool, error) {
+	if s.Size == 0 {
+		return false, nil
+	}
+	data, err := s.load(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	history := entries(data)
+	if len(history) > s.Size {
+		history = history[:s.Size]
+	}
+	for _, entry := range history {
+		if entry.matches(password) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Record agrega la contraseña nueva al historial, descarta las que exceden Size y guarda la fecha del cambio.
+// Se debe llamar cada vez que se establece una contraseña.
+func (s *Store) Record(ctx context.Context, uid, password string) error {
+	now := time.Now()
+	entry, err := newEntry(password, now)
+	if err != nil {
+		return err
+	}
+
+	ref := s.ref(uid)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var history []Entry
+		doc, err := tx.Get(ref)
+		if err == nil {
+			history = entries(doc.Data())
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		updates := map[string]interface{}{FieldChangedAt: now}
+		if s.Size > 0 {
+			history = append([]Entry{entry}, history...)
+			if len(history) > s.Size {
+				history = history[:s.Size]
+			}
+			updates[FieldHistory] = history
+		}
+		return tx.Set(ref, updates, firestore.MergeAll)
+	})
+}
+
+// Seed registra la contraseña actual de un usuario que aún no tiene historial (cuentas creadas antes del
+// historial), para que su antigüedad empiece a contar y no se pueda volver a usar. Devuelve la fecha del
+// último cambio conocida.
+func (s *Store) Seed(ctx context.Context, uid, password string) (time.Time, error) {
+	data, err := s.load(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if changedAt, ok := data[FieldChangedAt].(time.Time); ok {
+		return changedAt, nil
+	}
+	if err := s.Record(ctx, uid, password); err != nil {
+		return time.Time{}, err
+	}
+	return time.Now(), nil
+}
+
+// Expired indica si una contraseña cambiada en changedAt superó MaxAge
+func (s *Store) Expired(changedAt time.Time) bool {
+	return s.MaxAge > 0 && !changedAt.IsZero() && time.Since(changedAt) > s.MaxAge
+}
@@ -0,0 +1,133 @@
+// api/passwordpolicy/breached.go
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// prefixLength es el largo del prefijo del hash SHA-1 en el formato de k-anonimato (rangos)
+const prefixLength = 5
+
+// BreachedChecker indica cuántas veces apareció una contraseña en filtraciones conocidas
+type BreachedChecker interface {
+	Count(password string) (int, error)
+}
+
+// OpenBreached abre el conjunto de contraseñas filtradas en path. Si path es un directorio se usa como
+// RangeDir; si es un archivo se carga en memoria con LoadHashFile.
+func OpenBreached(path string) (BreachedChecker, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("PASSWORD_BREACHED_PATH inválido: %v", err)
+	}
+	if info.IsDir() {
+		return RangeDir(path), nil
+	}
+	return LoadHashFile(path)
+}
+
+// sha1Hex devuelve el SHA-1 de la contraseña en hexadecimal en mayúsculas, como en los conjuntos de filtraciones
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// RangeDir es un directorio con un archivo por prefijo de 5 caracteres del SHA-1 (por ejemplo 21BD1 o
+// 21BD1.txt), cada uno con líneas "SUFIJO:CANTIDAD", el mismo formato de k-anonimato de la API de rangos.
+// Solo se lee el archivo del prefijo consultado.
+type RangeDir string
+
+// Count implementa BreachedChecker
+func (d RangeDir) Count(password string) (int, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		file, err := os.Open(filepath.Join(string(d), name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lineSuffix, count := parseHashLine(scanner.Text())
+			if strings.EqualFold(lineSuffix, suffix) {
+				return count, nil
+			}
+		}
+		return 0, scanner.Err()
+	}
+	return 0, nil
+}
+
+// HashFile es un conjunto de hashes cargado en memoria, agrupado por prefijo
+type HashFile struct {
+	ranges map[string]map[string]int
+}
+
+// LoadHashFile carga un archivo con líneas "SHA1:CANTIDAD" (la cantidad es opcional). Las líneas vacías
+// y las que empiezan con # se ignoran.
+func LoadHashFile(path string) (*HashFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := &HashFile{ranges: map[string]map[string]int{}}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hash, count := parseHashLine(text)
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: hash SHA-1 inválido", path, line)
+		}
+		hash = strings.ToUpper(hash)
+		prefix := hash[:prefixLength]
+		if hashes.ranges[prefix] == nil {
+			hashes.ranges[prefix] = map[string]int{}
+		}
+		hashes.ranges[prefix][hash[prefixLength:]] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// Count implementa BreachedChecker
+func (h *HashFile) Count(password string) (int, error) {
+	hash := sha1Hex(password)
+	return h.ranges[hash[:prefixLength]][hash[prefixLength:]], nil
+}
+
+// parseHashLine separa una línea "HASH:CANTIDAD"; sin cantidad se cuenta como 1
+func parseHashLine(line string) (string, int) {
+	hash, countText, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found {
+		return hash, 1
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countText))
+	if err != nil || count < 1 {
+		count = 1
+	}
+	return hash, count
+}
@@ -0,0 +1,252 @@
+// api/passwordpolicy/policy.go
+package passwordpolicy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CharClass es una clase de caracteres que la política puede exigir
+type CharClass string
+
+const (
+	ClassLower  CharClass = "lower"
+	ClassUpper  CharClass = "upper"
+	ClassDigit  CharClass = "digit"
+	ClassSymbol CharClass = "symbol"
+)
+
+// Códigos de las infracciones de la política
+const (
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeMissingClass = "missing_class"
+	CodeBannedWord   = "banned_word"
+	CodeUserInfo     = "contains_user_info"
+	CodeTooWeak      = "too_weak"
+	CodeBreached     = "breached"
+)
+
+// minUserInputLength evita rechazar contraseñas por coincidir con fragmentos muy cortos del correo o el nombre
+const minUserInputLength = 3
+
+var classMessages = map[CharClass]string{
+	ClassLower:  "La contraseña debe incluir al menos una letra minúscula",
+	ClassUpper:  "La contraseña debe incluir al menos una letra mayúscula",
+	ClassDigit:  "La contraseña debe incluir al menos un número",
+	ClassSymbol: "La contraseña debe incluir al menos un símbolo",
+}
+
+// Violation es una regla de la política que la contraseña no cumple
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy define los requisitos de las contraseñas
+type Policy struct {
+	MinLength       int
+	MaxLength       int
+	RequiredClasses []CharClass
+	// BannedWords son palabras que la contraseña no puede contener (sin distinguir mayúsculas ni sustituciones como 4 por a)
+	BannedWords []string
+	// MinStrength es la fortaleza mínima según Strength, de 0 a 4
+	MinStrength int
+	// Breached comprueba la contraseña contra un conjunto de contraseñas filtradas; nil lo desactiva
+	Breached BreachedChecker
+}
+
+// Rules describe la política para el frontend. No incluye las palabras prohibidas.
+type Rules struct {
+	MinLength       int         `json:"minLength"`
+	MaxLength       int         `json:"maxLength"`
+	RequiredClasses []CharClass `json:"requiredClasses"`
+	MinStrength     int         `json:"minStrength"`
+	BannedWords     bool        `json:"bannedWords"`
+	UserInfo        bool        `json:"userInfo"`
+	BreachedCheck   bool        `json:"breachedCheck"`
+}
+
+// NewFromEnv crea la política a partir de PASSWORD_MIN_LENGTH (por defecto 8), PASSWORD_MAX_LENGTH
+// (por defecto 128), PASSWORD_REQUIRED_CLASSES (por defecto "lower,upper,digit"), PASSWORD_BANNED_WORDS,
+// PASSWORD_MIN_STRENGTH (por defecto 2) y PASSWORD_BREACHED_PATH (directorio de rangos o archivo de hashes).
+func NewFromEnv() (*Policy, error) {
+	policy := &Policy{MinLength: 8, MaxLength: 128, MinStrength: 2}
+
+	for name, target := range map[string]*int{
+		"PASSWORD_MIN_LENGTH":   &policy.MinLength,
+		"PASSWORD_MAX_LENGTH":   &policy.MaxLength,
+		"PASSWORD_MIN_STRENGTH": &policy.MinStrength,
+	} {
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s inválido: %q", name, value)
+		}
+		*target = n
+	}
+	if policy.MaxLength < policy.MinLength || policy.MinStrength > 4 {
+		return nil, fmt.Errorf("configuración de contraseñas inválida: longitud %d-%d, fortaleza %d", policy.MinLength, policy.MaxLength, policy.MinStrength)
+	}
+
+	classes, ok := os.LookupEnv("PASSWORD_REQUIRED_CLASSES")
+	if !ok {
+		classes = "lower,upper,digit"
+	}
+	for _, class := range splitList(classes) {
+		if _, known := classMessages[CharClass(class)]; !known {
+			return nil, fmt.Errorf("clase de caracteres desconocida en PASSWORD_REQUIRED_CLASSES: %q", class)
+		}
+		policy.RequiredClasses = append(policy.RequiredClasses, CharClass(class))
+	}
+
+	banned, ok := os.LookupEnv("PASSWORD_BANNED_WORDS")
+	if !ok {
+		banned = "password,contraseña,qwerty,123456,utem"
+	}
+	policy.BannedWords = splitList(banned)
+
+	if path := strings.TrimSpace(os.Getenv("PASSWORD_BREACHED_PATH")); path != "" {
+		checker, err := OpenBreached(path)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = checker
+	}
+
+	return policy, nil
+}
+
+// Rules devuelve la descripción pública de la política
+func (p *Policy) Rules() Rules {
+	classes := p.RequiredClasses
+	if classes == nil {
+		classes = []CharClass{}
+	}
+	return Rules{
+		MinLength:       p.MinLength,
+		MaxLength:       p.MaxLength,
+		RequiredClasses: classes,
+		MinStrength:     p.MinStrength,
+		BannedWords:     len(p.BannedWords) > 0,
+		UserInfo:        true,
+		BreachedCheck:   p.Breached != nil,
+	}
+}
+
+// Check devuelve las reglas que la contraseña no cumple. userInputs son datos del usuario (correo, nombre)
+// que la contraseña no debe contener. El error solo indica una falla al consultar las contraseñas filtradas.
+func (p *Policy) Check(password string, userInputs ...string) ([]Violation, error) {
+	violations := []Violation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{CodeTooShort, fmt.Sprintf("La contraseña debe tener al menos %d caracteres", p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{CodeTooLong, fmt.Sprintf("La contraseña debe tener como máximo %d caracteres", p.MaxLength)})
+	}
+
+	present := classesOf(password)
+	for _, class := range p.RequiredClasses {
+		if !present[class] {
+			violations = append(violations, Violation{CodeMissingClass, classMessages[class]})
+		}
+	}
+
+	normalized := normalize(password)
+	for _, word := range p.BannedWords {
+		if word = normalize(word); word != "" && strings.Contains(normalized, word) {
+			violations = append(violations, Violation{CodeBannedWord, "La contraseña contiene una palabra demasiado común"})
+			break
+		}
+	}
+
+	words := userWords(userInputs)
+	for _, word := range words {
+		if strings.Contains(normalized, normalize(word)) {
+			violations = append(violations, Violation{CodeUserInfo, "La contraseña no puede contener tu correo ni tu nombre"})
+			break
+		}
+	}
+
+	if Strength(password, append(words, p.BannedWords...)...) < p.MinStrength {
+		violations = append(violations, Violation{CodeTooWeak, "La contraseña es demasiado fácil de adivinar"})
+	}
+
+	if p.Breached != nil {
+		count, err := p.Breached.Count(password)
+		if err != nil {
+			return violations, fmt.Errorf("error al consultar las contraseñas filtradas: %v", err)
+		}
+		if count > 0 {
+			violations = append(violations, Violation{CodeBreached, "La contraseña apareció en una filtración de datos; elige otra"})
+		}
+	}
+
+	return violations, nil
+}
+
+// classesOf indica qué clases de caracteres contiene la contraseña
+func classesOf(password string) map[CharClass]bool {
+	present := map[CharClass]bool{}
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			present[ClassLower] = true
+		case unicode.IsUpper(r):
+			present[ClassUpper] = true
+		case unicode.IsDigit(r):
+			present[ClassDigit] = true
+		default:
+			present[ClassSymbol] = true
+		}
+	}
+	return present
+}
+
+// leetReplacer deshace las sustituciones habituales para comparar con las palabras prohibidas
+var leetReplacer = strings.NewReplacer("0", "o", "1", "i", "!", "i", "3", "e", "4", "a", "@", "a", "5", "s", "$", "s", "7", "t")
+
+func normalize(value string) string {
+	return leetReplacer.Replace(strings.ToLower(strings.TrimSpace(value)))
+}
+
+// userWords separa el correo y el nombre en las palabras que la contraseña no debe contener
+func userWords(inputs []string) []string {
+	var words []string
+	for _, input := range inputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			continue
+		}
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			input = local
+		}
+		for _, word := range strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(word) >= minUserInputLength {
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,107 @@
+// api/passwordpolicy/strength.go
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Umbrales de entropía (bits) de cada nivel de fortaleza; por encima del último la fortaleza es 4
+var strengthThresholds = []float64{25, 35, 45, 60}
+
+// keyboardRows se usan para detectar secuencias de teclado como "qwerty" o "asdf"
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+// Strength estima la fortaleza de la contraseña de 0 (muy débil) a 4 (muy fuerte). Calcula la entropía
+// según las clases de caracteres usadas, sin contar los caracteres repetidos, las secuencias (abc, 321,
+// qwerty) ni las palabras conocidas, que cuentan como un único carácter.
+func Strength(password string, knownWords ...string) int {
+	runes := []rune(strings.ToLower(password))
+	if len(runes) == 0 {
+		return 0
+	}
+
+	// Las palabras conocidas (prohibidas, correo, nombre) aportan como un solo carácter
+	predictable := make([]bool, len(runes))
+	normalized := []rune(normalize(password))
+	if len(normalized) == len(runes) {
+		for _, word := range knownWords {
+			markWord(predictable, normalized, []rune(normalize(word)))
+		}
+	}
+
+	effective := 0.0
+	for i, r := range runes {
+		switch {
+		case predictable[i]:
+			if i == 0 || !predictable[i-1] {
+				effective++
+			}
+		case i > 0 && (r == runes[i-1] || isSequence(runes[i-1], r)):
+			// repetición o secuencia: casi no aporta
+			effective += 0.25
+		default:
+			effective++
+		}
+	}
+
+	bits := effective * math.Log2(float64(charsetSize(password)))
+	for level, threshold := range strengthThresholds {
+		if bits < threshold {
+			return level
+		}
+	}
+	return len(strengthThresholds)
+}
+
+// markWord marca como predecibles las apariciones de word en la contraseña
+func markWord(predictable []bool, password, word []rune) {
+	if len(word) < minUserInputLength || len(word) > len(password) {
+		return
+	}
+	for i := 0; i+len(word) <= len(password); i++ {
+		if string(password[i:i+len(word)]) == string(word) {
+			for j := i; j < i+len(word); j++ {
+				predictable[j] = true
+			}
+		}
+	}
+}
+
+// isSequence indica si b sigue a a en el alfabeto, en los dígitos o en una fila del teclado, en cualquier sentido
+func isSequence(a, b rune) bool {
+	if b == a+1 || b == a-1 {
+		return unicode.IsLetter(a) == unicode.IsLetter(b)
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (j == i+1 || j == i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetSize estima el tamaño del alfabeto según las clases de caracteres presentes
+func charsetSize(password string) int {
+	size := 0
+	present := classesOf(password)
+	if present[ClassLower] {
+		size += 26
+	}
+	if present[ClassUpper] {
+		size += 26
+	}
+	if present[ClassDigit] {
+		size += 10
+	}
+	if present[ClassSymbol] {
+		size += 33
+	}
+	if size < 2 {
+		return 2
+	}
+	return size
+}
@@ -0,0 +1,119 @@
+// api/ratelimit/memory.go
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval es cada cuánto se eliminan las claves que ya volvieron a su estado inicial
+const memorySweepInterval = time.Minute
+
+// MemoryStore guarda el uso de los límites en memoria. Cada réplica cuenta por separado, por lo que
+// solo sirve con una instancia o en desarrollo; con varias réplicas se debe usar RedisStore.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	// token bucket
+	tokens    float64
+	updatedAt time.Time
+	// ventana deslizante: instantes de las solicitudes permitidas dentro del periodo
+	hits []time.Time
+	// expiresAt es el instante desde el que la entrada equivale a una clave nueva
+	expiresAt time.Time
+}
+
+// NewMemoryStore crea un MemoryStore vacío
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+// Allow implementa Store
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{tokens: float64(limit.capacity()), updatedAt: now}
+		s.entries[key] = entry
+	}
+
+	var result Result
+	if limit.Algorithm == TokenBucket {
+		result = entry.takeToken(limit, now)
+	} else {
+		result = entry.addHit(limit, now)
+	}
+	entry.expiresAt = now.Add(result.Reset)
+	return result, nil
+}
+
+// takeToken repone las fichas transcurridas desde el último uso y consume una
+func (e *memoryEntry) takeToken(limit Limit, now time.Time) Result {
+	capacity := float64(limit.capacity())
+	perSecond := float64(limit.Rate) / limit.Period.Seconds()
+
+	e.tokens = math.Min(capacity, e.tokens+now.Sub(e.updatedAt).Seconds()*perSecond)
+	e.updatedAt = now
+
+	result := Result{Limit: limit.capacity()}
+	if e.tokens >= 1 {
+		e.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - e.tokens) / perSecond)
+	}
+	result.Remaining = int(e.tokens)
+	result.Reset = seconds((capacity - e.tokens) / perSecond)
+	return result
+}
+
+// addHit descarta las solicitudes fuera de la ventana y registra la actual si cabe
+func (e *memoryEntry) addHit(limit Limit, now time.Time) Result {
+	windowStart := now.Add(-limit.Period)
+	kept := e.hits[:0]
+	for _, hit := range e.hits {
+		if hit.After(windowStart) {
+			kept = append(kept, hit)
+		}
+	}
+	e.hits = kept
+
+	result := Result{Limit: limit.Rate}
+	if len(e.hits) < limit.Rate {
+		e.hits = append(e.hits, now)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = e.hits[0].Add(limit.Period).Sub(now)
+	}
+	result.Remaining = limit.Rate - len(e.hits)
+	result.Reset = e.hits[len(e.hits)-1].Add(limit.Period).Sub(now)
+	return result
+}
+
+// sweep elimina periódicamente las entradas vencidas para que la memoria no crezca con cada clave vista
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,127 @@
+// api/ratelimit/ratelimit.go
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm es el algoritmo con el que se cuenta el uso de un límite
+type Algorithm string
+
+const (
+	// TokenBucket permite ráfagas de hasta Burst solicitudes y repone Rate fichas cada Period
+	TokenBucket Algorithm = "token"
+	// SlidingWindow permite como máximo Rate solicitudes en cualquier intervalo de duración Period
+	SlidingWindow Algorithm = "sliding"
+)
+
+// Limit define cuántas solicitudes se permiten por clave
+type Limit struct {
+	Algorithm Algorithm
+	Rate      int
+	Period    time.Duration
+	// Burst es la capacidad del token bucket; si es 0 se usa Rate. No aplica a SlidingWindow.
+	Burst int
+}
+
+// capacity devuelve la cantidad máxima de solicitudes seguidas que admite el límite
+func (l Limit) capacity() int {
+	if l.Algorithm == TokenBucket && l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// String devuelve el límite en el formato de ParseLimit
+func (l Limit) String() string {
+	return fmt.Sprintf("%s:%d/%s", l.Algorithm, l.Rate, l.Period)
+}
+
+// ParseLimit interpreta un límite con la forma "[algoritmo:]rate/period", por ejemplo "5/1h"
+// (ventana deslizante) o "token:10/1m" (token bucket)
+func ParseLimit(spec string) (Limit, error) {
+	limit := Limit{Algorithm: SlidingWindow}
+	spec = strings.TrimSpace(spec)
+
+	if algorithm, rest, ok := strings.Cut(spec, ":"); ok {
+		switch Algorithm(algorithm) {
+		case TokenBucket, SlidingWindow:
+			limit.Algorithm = Algorithm(algorithm)
+		default:
+			return limit, fmt.Errorf("algoritmo de rate limit desconocido: %q", algorithm)
+		}
+		spec = rest
+	}
+
+	rate, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return limit, fmt.Errorf("límite inválido: %q", spec)
+	}
+	n, err := strconv.Atoi(rate)
+	if err != nil || n <= 0 {
+		return limit, fmt.Errorf("cantidad inválida en el límite: %q", rate)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return limit, fmt.Errorf("periodo inválido en el límite: %q", period)
+	}
+
+	limit.Rate = n
+	limit.Period = d
+	return limit, nil
+}
+
+// LimitFromEnv lee el límite de la variable RATE_LIMIT_<NAME> (por ejemplo RATE_LIMIT_REGISTER_IP)
+// o usa el valor por defecto
+func LimitFromEnv(name, fallback string) (Limit, error) {
+	variable := "RATE_LIMIT_" + strings.ToUpper(name)
+	spec := os.Getenv(variable)
+	if strings.TrimSpace(spec) == "" {
+		spec = fallback
+	}
+	limit, err := ParseLimit(spec)
+	if err != nil {
+		return limit, fmt.Errorf("%s: %v", variable, err)
+	}
+	return limit, nil
+}
+
+// Result es el resultado de consumir una solicitud de un límite
+type Result struct {
+	Allowed bool
+	// Limit es la cantidad máxima de solicitudes seguidas
+	Limit     int
+	Remaining int
+	// Reset es el tiempo hasta que el límite vuelva a estar completo
+	Reset time.Duration
+	// RetryAfter es el tiempo hasta que se permita la siguiente solicitud, si fue rechazada
+	RetryAfter time.Duration
+}
+
+// Store guarda el uso de los límites
+type Store interface {
+	// Allow consume una solicitud de la clave y devuelve si se permite
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// NewStoreFromEnv crea el Store configurado en RATE_LIMIT_STORE: "memory" (por defecto, por proceso)
+// o "redis" (compartido entre réplicas, usa REDIS_URL)
+func NewStoreFromEnv() (Store, error) {
+	switch backend := strings.TrimSpace(os.Getenv("RATE_LIMIT_STORE")); backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			return nil, fmt.Errorf("REDIS_URL no está configurado")
+		}
+		return NewRedisStoreFromURL(url)
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_STORE desconocido: %q", backend)
+	}
+}
@@ -0,0 +1,121 @@
+// api/ratelimit/redis.go
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Los scripts usan la hora del servidor Redis para que todas las réplicas cuenten con el mismo reloj.
+// Ambos devuelven {permitida, restantes, reset en ms, retry-after en ms}.
+var (
+	tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local perMs = tonumber(ARGV[2]) / tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + (now - ts) * perMs)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / perMs)
+end
+local reset = math.ceil((capacity - tokens) / perMs)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+	slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - period)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+local retry = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+else
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	retry = tonumber(oldest[2]) + period - now
+end
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+local reset = tonumber(newest[2]) + period - now
+
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, limit - count, reset, retry}
+`)
+)
+
+// RedisStore guarda el uso de los límites en Redis, compartido entre todas las réplicas
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore crea un RedisStore con el cliente dado
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+// NewRedisStoreFromURL crea un RedisStore a partir de una URL redis:// o rediss://
+func NewRedisStoreFromURL(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL inválido: %v", err)
+	}
+	return NewRedisStore(redis.NewClient(options)), nil
+}
+
+// Allow implementa Store
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	keys := []string{s.prefix + string(limit.Algorithm) + ":" + key}
+
+	var (
+		values []int64
+		err    error
+	)
+	if limit.Algorithm == TokenBucket {
+		values, err = tokenBucketScript.Run(ctx, s.client, keys, limit.capacity(), limit.Rate, limit.Period.Milliseconds()).Int64Slice()
+	} else {
+		// El miembro del sorted set debe ser único aunque dos solicitudes lleguen en el mismo milisegundo
+		member := fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Int63())
+		values, err = slidingWindowScript.Run(ctx, s.client, keys, limit.Rate, limit.Period.Milliseconds(), member).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("error al consultar el rate limit en Redis: %v", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("respuesta inesperada del rate limit en Redis: %v", values)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.capacity(),
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
@@ -3,10 +3,24 @@
 package api
 
 import (
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
 
+	"backend/api/approvals"
+	"backend/api/audit"
+	"backend/api/authz"
+	"backend/api/captcha"
+	"backend/api/claims"
 	"backend/api/controllers"
+	"backend/api/domainpolicy"
+	"backend/api/lockout"
 	"backend/api/middleware"
+	"backend/api/orgs"
+	"backend/api/passwordhistory"
+	"backend/api/passwordpolicy"
+	"backend/api/ratelimit"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
@@ -15,32 +29,277 @@ import (
 
 // SetupRouter configura las rutas para el módulo de autenticación
 func SetupRouter(r *gin.Engine, firestoreClient *firestore.Client, authClient *auth.Client, storageClient *storage.Client) {
+	// Las operaciones sensibles exigen una autenticación de hace menos de 5 minutos
+	recentAuth := middleware.RequireRecentAuth(firestoreClient, 5*time.Minute)
+	// Durante una suplantación no se permiten cambios de credenciales, correo ni la eliminación de la cuenta
+	noImpersonation := middleware.BlockImpersonation()
+
+	// Todas las escrituras de custom claims pasan por el manager para no sobrescribir claims ajenos
+	claimsManager := claims.NewManager(authClient, claims.DefaultKeys...)
+
+	// Registro de auditoría (AUDIT_SINKS)
+	auditLogger, err := audit.NewLoggerFromEnv(firestoreClient)
+	if err != nil {
+		log.Fatalf("Error al configurar el registro de auditoría: %v", err)
+	}
+	audit.SetDefault(auditLogger)
+
+	// Las organizaciones se guardan en Firestore o como tenants de Firebase Auth según ORG_BACKEND
+	orgStore, err := orgs.NewStoreFromEnv(firestoreClient, authClient)
+	if err != nil {
+		log.Fatalf("Error al configurar las organizaciones: %v", err)
+	}
+
+	// Protección contra fuerza bruta en /login (LOGIN_MAX_FAILURES, LOGIN_MAX_IP_FAILURES, LOGIN_LOCK_DURATION)
+	loginGuard, err := lockout.NewGuardFromEnv(firestoreClient)
+	if err != nil {
+		log.Fatalf("Error al configurar la protección de inicio de sesión: %v", err)
+	}
+
+	// Rate limit por ruta y por clave (RATE_LIMIT_STORE, RATE_LIMIT_<REGLA>)
+	rateLimitStore, err := ratelimit.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Error al configurar el rate limit: %v", err)
+	}
+	rateLimit := func(name, fallback string, key middleware.RateLimitKey) gin.HandlerFunc {
+		limit, err := ratelimit.LimitFromEnv(name, fallback)
+		if err != nil {
+			log.Fatalf("Error al configurar el rate limit: %v", err)
+		}
+		return middleware.RateLimit(rateLimitStore, name, limit, key)
+	}
+
+	// Política de contraseñas (PASSWORD_*), aplicada al registro, al cambio de contraseña, a las invitaciones
+	// y al vincular una contraseña
+	passwordPolicy, err := passwordpolicy.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Error al configurar la política de contraseñas: %v", err)
+	}
+
+	// Historial de contraseñas (PASSWORD_HISTORY_SIZE) y antigüedad máxima (PASSWORD_MAX_AGE)
+	passwordHistory, err := passwordhistory.NewStoreFromEnv(firestoreClient)
+	if err != nil {
+		log.Fatalf("Error al configurar el historial de contraseñas: %v", err)
+	}
+
+	// Política de dominios de registro (REGISTRATION_*): dominios permitidos y bloqueados, correos
+	// desechables, MX y rol por dominio al verificar
+	domainPolicy, err := domainpolicy.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Error al configurar la política de dominios de registro: %v", err)
+	}
+
+	// Aprobación de registros (REGISTRATION_APPROVAL): las cuentas verificadas esperan a un administrador
+	approvalQueue, err := approvals.NewQueueFromEnv(firestoreClient)
+	if err != nil {
+		log.Fatalf("Error al configurar la aprobación de registros: %v", err)
+	}
+
+	// CAPTCHA de los endpoints públicos (CAPTCHA_PROVIDER); sin proveedor no se exige
+	captchaVerifier, err := captcha.NewVerifierFromEnv(rateLimitStore)
+	if err != nil {
+		log.Fatalf("Error al configurar el CAPTCHA: %v", err)
+	}
+
 	authRoutes := r.Group("/")
 	{
-		authRoutes.POST("/login", controllers.LoginUser)
-		authRoutes.POST("/register", func(c *gin.Context) {
-			controllers.RegisterUser(c, firestoreClient)
+		authRoutes.POST("/login", func(c *gin.Context) {
+			controllers.LoginUser(c, firestoreClient, authClient, loginGuard, passwordHistory)
+		})
+		authRoutes.POST("/register", rateLimit("register_ip", "10/1h", middleware.RateLimitByIP), rateLimit("register_email", "3/1h", middleware.RateLimitByBodyField("email")), middleware.Captcha(captchaVerifier), func(c *gin.Context) {
+			controllers.RegisterUser(c, firestoreClient, passwordPolicy, passwordHistory, domainPolicy)
 		})
-		authRoutes.POST("/verify-code", func(c *gin.Context) {
-			controllers.VerifyCode(c, firestoreClient, authClient)
+		authRoutes.POST("/verify-code", rateLimit("verify_code_ip", "token:20/10m", middleware.RateLimitByIP), rateLimit("verify_code_uid", "5/10m", middleware.RateLimitByAccount(authClient, "uid", "email")), func(c *gin.Context) {
+			controllers.VerifyCode(c, firestoreClient, authClient, claimsManager, domainPolicy, approvalQueue)
 		})
-		authRoutes.POST("/resend-code", middleware.AuthMiddleware(authClient), func(c *gin.Context) {
+		authRoutes.POST("/resend-code", middleware.AuthMiddleware(authClient, firestoreClient), rateLimit("resend_code_uid", "3/10m", middleware.RateLimitByUID), func(c *gin.Context) {
 			controllers.ResendCode(c, firestoreClient)
 		})
-		authRoutes.PATCH("/update", middleware.AuthMiddleware(authClient), func(c *gin.Context) {
+		authRoutes.PATCH("/update", middleware.AuthMiddleware(authClient, firestoreClient), func(c *gin.Context) {
 			controllers.UpdateProfile(c, firestoreClient, authClient)
 		})
-		authRoutes.POST("/upload-photo", middleware.AuthMiddleware(authClient), func(c *gin.Context) {
+		authRoutes.POST("/upload-photo", middleware.AuthMiddleware(authClient, firestoreClient), func(c *gin.Context) {
 			controllers.UploadPhoto(c, firestoreClient, storageClient, authClient)
 		})
-		authRoutes.POST("/forgot-password", func(c *gin.Context) {
+		authRoutes.DELETE("/photo", middleware.AuthMiddleware(authClient, firestoreClient), recentAuth, func(c *gin.Context) {
+			controllers.DeletePhoto(c, firestoreClient, storageClient, authClient)
+		})
+		authRoutes.GET("/password-policy", func(c *gin.Context) {
+			controllers.GetPasswordPolicy(c, passwordPolicy)
+		})
+		authRoutes.GET("/captcha", rateLimit("captcha_ip", "60/1m", middleware.RateLimitByIP), func(c *gin.Context) {
+			controllers.GetCaptcha(c, captchaVerifier)
+		})
+		authRoutes.POST("/forgot-password", rateLimit("forgot_password_ip", "10/1h", middleware.RateLimitByIP), rateLimit("forgot_password_email", "3/1h", middleware.RateLimitByBodyField("email")), middleware.Captcha(captchaVerifier), func(c *gin.Context) {
 			controllers.ForgotPassword(c, authClient, firestoreClient)
 		})
+		// El token del correo de restablecimiento ya prueba el acceso reciente al correo, por eso esta ruta no
+		// usa recentAuth; con la sesión iniciada la contraseña se cambia en PUT /password
 		authRoutes.POST("/change-password", middleware.JWTMiddleware(), func(c *gin.Context) {
-			controllers.ChangePassword(c, authClient)
+			controllers.ChangePassword(c, firestoreClient, authClient, passwordPolicy, passwordHistory)
+		})
+		authRoutes.PUT("/password", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, recentAuth, func(c *gin.Context) {
+			controllers.UpdatePassword(c, firestoreClient, authClient, passwordPolicy, passwordHistory)
+		})
+		authRoutes.POST("/token/scoped", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, middleware.RequireFirebaseSession(), func(c *gin.Context) {
+			controllers.IssueScopedToken(c, authClient)
+		})
+		authRoutes.GET("/validate-token", middleware.AuthMiddleware(authClient, firestoreClient), func(c *gin.Context) {
+			controllers.ValidateToken(c, authClient, claimsManager)
+		})
+		authRoutes.POST("/change-email", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, recentAuth, func(c *gin.Context) {
+			controllers.ChangeEmail(c, firestoreClient, authClient, domainPolicy)
+		})
+		authRoutes.POST("/change-email/confirm", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, func(c *gin.Context) {
+			controllers.ConfirmEmailChange(c, firestoreClient, authClient)
+		})
+		authRoutes.POST("/change-email/undo", func(c *gin.Context) {
+			controllers.UndoEmailChange(c, firestoreClient, authClient)
+		})
+		authRoutes.DELETE("/account", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, recentAuth, func(c *gin.Context) {
+			controllers.DeleteAccount(c, firestoreClient, authClient)
+		})
+		authRoutes.GET("/account/export", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, func(c *gin.Context) {
+			controllers.ExportAccount(c, firestoreClient, authClient, storageClient)
+		})
+		authRoutes.POST("/account/restore", func(c *gin.Context) {
+			controllers.RestoreAccount(c, firestoreClient, authClient)
+		})
+		authRoutes.POST("/account/lock", func(c *gin.Context) {
+			controllers.LockAccount(c, firestoreClient, authClient)
+		})
+		authRoutes.GET("/notifications/preferences", middleware.AuthMiddleware(authClient, firestoreClient), func(c *gin.Context) {
+			controllers.GetNotificationPreferences(c, firestoreClient)
+		})
+		authRoutes.PUT("/notifications/preferences", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, func(c *gin.Context) {
+			controllers.UpdateNotificationPreferences(c, firestoreClient)
+		})
+		authRoutes.POST("/invitations/accept", middleware.OptionalAuthMiddleware(authClient, firestoreClient), noImpersonation, func(c *gin.Context) {
+			controllers.AcceptInvitation(c, firestoreClient, authClient, orgStore, claimsManager, passwordPolicy, passwordHistory)
+		})
+		authRoutes.POST("/reauthenticate", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, middleware.RequireFirebaseSession(), rateLimit("reauthenticate_uid", "10/15m", middleware.RateLimitByUID), func(c *gin.Context) {
+			controllers.Reauthenticate(c, firestoreClient, authClient, loginGuard)
+		})
+		authRoutes.GET("/identities", middleware.AuthMiddleware(authClient, firestoreClient), func(c *gin.Context) {
+			controllers.ListIdentities(c, firestoreClient, authClient)
+		})
+		authRoutes.POST("/identities/link", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, middleware.RequireFirebaseSession(), recentAuth, func(c *gin.Context) {
+			controllers.LinkIdentity(c, firestoreClient, authClient, passwordPolicy, passwordHistory)
+		})
+		authRoutes.DELETE("/identities/:provider", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, middleware.RequireFirebaseSession(), recentAuth, func(c *gin.Context) {
+			controllers.UnlinkIdentity(c, firestoreClient, authClient)
+		})
+	}
+
+	// Rutas de administración, restringidas al rol admin
+	// Las API keys solo se administran con una sesión de Firebase, no con otra API key
+	apiKeyRoutes := r.Group("/api-keys", middleware.AuthMiddleware(authClient, firestoreClient), noImpersonation, middleware.RequireFirebaseSession())
+	{
+		apiKeyRoutes.POST("", func(c *gin.Context) {
+			controllers.CreateAPIKey(c, firestoreClient)
+		})
+		apiKeyRoutes.GET("", func(c *gin.Context) {
+			controllers.ListAPIKeys(c, firestoreClient)
+		})
+		apiKeyRoutes.DELETE("/:id", func(c *gin.Context) {
+			controllers.RevokeAPIKey(c, firestoreClient)
+		})
+	}
+
+	orgRoutes := r.Group("/organizations", middleware.AuthMiddleware(authClient, firestoreClient))
+	{
+		orgMember := middleware.RequireOrgMember(orgStore, orgs.RoleMember)
+		orgAdmin := middleware.RequireOrgMember(orgStore, orgs.RoleAdmin)
+
+		orgRoutes.POST("", middleware.RequirePermission(authz.PermOrgsCreate), func(c *gin.Context) {
+			controllers.CreateOrganization(c, orgStore)
+		})
+		orgRoutes.GET("", func(c *gin.Context) {
+			controllers.ListMyOrganizations(c, orgStore)
+		})
+		orgRoutes.GET("/:orgId", orgMember, func(c *gin.Context) {
+			controllers.GetOrganization(c, orgStore)
+		})
+		orgRoutes.GET("/:orgId/members", orgMember, func(c *gin.Context) {
+			controllers.ListOrganizationMembers(c, orgStore)
+		})
+		orgRoutes.PUT("/:orgId/members/:uid", orgAdmin, func(c *gin.Context) {
+			controllers.SetOrganizationMember(c, orgStore, authClient, claimsManager)
+		})
+		orgRoutes.DELETE("/:orgId/members/:uid", orgMember, func(c *gin.Context) {
+			controllers.RemoveOrganizationMember(c, orgStore, claimsManager)
+		})
+		orgRoutes.POST("/:orgId/switch", orgMember, func(c *gin.Context) {
+			controllers.SwitchOrganization(c, claimsManager)
+		})
+	}
+
+	// La administración exige permisos concretos (ver ROLE_PERMISSIONS); por defecto staff puede consultar
+	// usuarios y admin puede modificarlos
+	adminRoutes := r.Group("/admin", middleware.AuthMiddleware(authClient, firestoreClient))
+	{
+		usersRead := middleware.RequirePermission(authz.PermUsersRead)
+		usersWrite := middleware.RequirePermission(authz.PermUsersWrite)
+		usersAdmin := middleware.RequirePermission(authz.PermUsersAdmin)
+		// Cambiar roles exige además el rol más alto de la jerarquía: ROLE_PERMISSIONS puede conceder
+		// users:admin a roles inferiores, que de otro modo podrían asignar a otros un rol superior al propio
+		rolesAdmin := middleware.RequireRole(authz.Roles().Highest())
+
+		adminRoutes.GET("/users", usersRead, func(c *gin.Context) {
+			controllers.AdminListUsers(c, authClient)
+		})
+		adminRoutes.GET("/users/:uid", usersRead, func(c *gin.Context) {
+			controllers.AdminGetUser(c, firestoreClient, authClient)
+		})
+		adminRoutes.GET("/users/:uid/permissions", usersRead, func(c *gin.Context) {
+			controllers.AdminGetUserPermissions(c, authClient)
+		})
+		adminRoutes.POST("/users/:uid/disable", usersWrite, func(c *gin.Context) {
+			controllers.AdminSetUserDisabled(c, firestoreClient, authClient, true)
+		})
+		adminRoutes.POST("/users/:uid/enable", usersWrite, func(c *gin.Context) {
+			controllers.AdminSetUserDisabled(c, firestoreClient, authClient, false)
+		})
+		adminRoutes.POST("/users/:uid/unlock", usersWrite, func(c *gin.Context) {
+			controllers.AdminUnlockUser(c, authClient, loginGuard)
+		})
+		adminRoutes.POST("/users/:uid/verify-email", usersWrite, func(c *gin.Context) {
+			controllers.AdminForceVerifyEmail(c, firestoreClient, authClient, claimsManager, domainPolicy, approvalQueue)
+		})
+		adminRoutes.POST("/users/:uid/resend-code", usersWrite, func(c *gin.Context) {
+			controllers.AdminResendCode(c, firestoreClient, authClient)
+		})
+		adminRoutes.DELETE("/users/:uid", usersAdmin, func(c *gin.Context) {
+			controllers.AdminDeleteUser(c, firestoreClient, authClient, storageClient)
+		})
+		adminRoutes.POST("/users/:uid/impersonate", usersAdmin, func(c *gin.Context) {
+			controllers.AdminImpersonateUser(c, firestoreClient, authClient)
+		})
+		adminRoutes.GET("/approvals", usersRead, func(c *gin.Context) {
+			controllers.AdminListApprovals(c, approvalQueue)
+		})
+		adminRoutes.POST("/approvals/:uid/approve", usersWrite, func(c *gin.Context) {
+			controllers.AdminApproveRegistration(c, approvalQueue, claimsManager, domainPolicy)
+		})
+		adminRoutes.POST("/approvals/:uid/reject", usersWrite, func(c *gin.Context) {
+			controllers.AdminRejectRegistration(c, approvalQueue, authClient)
+		})
+		adminRoutes.POST("/invitations", usersAdmin, func(c *gin.Context) {
+			controllers.AdminCreateInvitation(c, firestoreClient, orgStore)
+		})
+		adminRoutes.GET("/invitations", usersRead, func(c *gin.Context) {
+			controllers.AdminListInvitations(c, firestoreClient)
+		})
+		adminRoutes.DELETE("/invitations/:id", usersAdmin, func(c *gin.Context) {
+			controllers.AdminRevokeInvitation(c, firestoreClient)
+		})
+		adminRoutes.GET("/audit", middleware.RequirePermission(authz.PermAuditRead), controllers.AdminListAuditEvents)
+		adminRoutes.GET("/roles", usersRead, controllers.AdminListRoles)
+		adminRoutes.PUT("/users/:uid/role", usersAdmin, rolesAdmin, func(c *gin.Context) {
+			controllers.AdminAssignRole(c, authClient, claimsManager)
 		})
-		authRoutes.GET("/validate-token", middleware.AuthMiddleware(authClient), func(c *gin.Context) {
-			controllers.ValidateToken(c, authClient)
+		adminRoutes.DELETE("/users/:uid/role", usersAdmin, rolesAdmin, func(c *gin.Context) {
+			controllers.AdminRevokeRole(c, authClient, claimsManager)
 		})
 	}
 }
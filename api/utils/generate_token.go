@@ -10,21 +10,39 @@ import (
 
 var SecretKey = []byte(os.Getenv("SECRET_KEY"))
 
+// Propósitos de los tokens firmados, para que un token emitido para un flujo no sirva en otro
+const (
+	PurposePasswordReset  = "password_reset"
+	PurposeEmailUndo      = "email_undo"
+	PurposeAccountRestore = "account_restore"
+	PurposeInvitation     = "invitation"
+	PurposeAccountLock    = "account_lock"
+)
+
 // Claims estructura para almacenar los claims del token JWT
 type Claims struct {
-	Email string `json:"email"`
-	UID   string `json:"uid"`
+	Email   string `json:"email"`
+	UID     string `json:"uid"`
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
 // GenerarToken genera un JWT para restablecimiento de contraseña
 func GenerarToken(email, uid string) (string, error) {
+	return GenerarTokenConProposito(email, uid, PurposePasswordReset, "", 30*time.Minute) // Token expira en 30 minutos
+}
+
+// GenerarTokenConProposito genera un JWT firmado para el propósito indicado, con un ID opcional y una duración
+func GenerarTokenConProposito(email, uid, purpose, id string, duration time.Duration) (string, error) {
 	// Crear token con un payload (claims)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		email,
-		uid,
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(30 * time.Minute).Unix(), // Token expira en 30 minutos
+		Email:   email,
+		UID:     uid,
+		Purpose: purpose,
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(duration).Unix(),
 		},
 	})
 
@@ -61,6 +79,20 @@ func VerificarToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// VerificarTokenConProposito verifica un token JWT y comprueba que haya sido emitido para el propósito indicado
+func VerificarTokenConProposito(tokenString, purpose string) (*Claims, error) {
+	claims, err := VerificarToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != purpose {
+		return nil, fmt.Errorf("el token no es válido para esta operación")
+	}
+
+	return claims, nil
+}
+
 // IsTokenExpired verifica si el token JWT ha expirado
 func (c *Claims) IsTokenExpired() bool {
 	return c.ExpiresAt < time.Now().Unix()
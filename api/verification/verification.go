@@ -0,0 +1,189 @@
+// api/verification/verification.go
+package verification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"backend/api/utils"
+
+	"cloud.google.com/go/firestore"
+)
+
+// MaxAttempts es la cantidad de intentos fallidos tras la cual el código se invalida
+const MaxAttempts = 5
+
+// codeSpace es la cantidad de códigos posibles de 6 dígitos
+var codeSpace = big.NewInt(1000000)
+
+var (
+	// ErrNoCode indica que no hay un código pendiente
+	ErrNoCode = errors.New("no hay un código pendiente")
+	// ErrExpired indica que el código venció
+	ErrExpired = errors.New("código expirado")
+	// ErrInvalidCode indica que el código no coincide
+	ErrInvalidCode = errors.New("código incorrecto")
+	// ErrTooManyAttempts indica que el código se invalidó por exceso de intentos fallidos
+	ErrTooManyAttempts = errors.New("se superó el máximo de intentos; solicita un código nuevo")
+)
+
+// Fields indica en qué campos de un documento se guarda un código. Purpose se incluye en el HMAC, de
+// modo que el hash de un flujo no sirva para otro.
+type Fields struct {
+	Purpose    string
+	Hash       string
+	ValidUntil string
+	Attempts   string
+	// Legacy es el campo donde antes se guardaba el código en texto plano. Mientras no haya un hash, Verify
+	// lo acepta una vez (con el mismo vencimiento y límite de intentos) para no dejar sin salida a quienes
+	// tenían un código pendiente al desplegar el cambio. Un código nuevo tiene prioridad y, al usarse, también
+	// elimina el anterior.
+	Legacy string
+}
+
+// Campos de los códigos guardados en users/{uid}
+var (
+	Registration = Fields{
+		Purpose:    "registration",
+		Hash:       "verificationCodeHash",
+		ValidUntil: "codeValidUntil",
+		Attempts:   "verificationAttempts",
+		Legacy:     "verificationCode",
+	}
+	EmailChange = Fields{
+		Purpose:    "email_change",
+		Hash:       "pendingEmailCodeHash",
+		ValidUntil: "pendingEmailValidUntil",
+		Attempts:   "pendingEmailAttempts",
+		Legacy:     "pendingEmailCode",
+	}
+)
+
+// Generate genera un código de 6 dígitos con crypto/rand
+func Generate() (string, error) {
+	n, err := rand.Int(rand.Reader, codeSpace)
+	if err != nil {
+		return "", fmt.Errorf("error al generar el código: %v", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// secret es la clave del HMAC: VERIFICATION_CODE_SECRET o, si no está configurada, SECRET_KEY
+func secret() []byte {
+	if value := os.Getenv("VERIFICATION_CODE_SECRET"); value != "" {
+		return []byte(value)
+	}
+	return utils.SecretKey
+}
+
+// hash calcula el HMAC-SHA256 del código ligado al propósito y al UID
+func (f Fields) hash(uid, code string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(f.Purpose + ":" + uid + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Issue genera un código nuevo y devuelve los valores que se deben guardar en el documento. El código
+// solo se guarda como HMAC y el contador de intentos vuelve a cero.
+func (f Fields) Issue(uid string, ttl time.Duration) (string, map[string]interface{}, error) {
+	code, err := Generate()
+	if err != nil {
+		return "", nil, err
+	}
+	return code, map[string]interface{}{
+		f.Hash:       f.hash(uid, code),
+		f.ValidUntil: time.Now().Add(ttl),
+		f.Attempts:   0,
+	}, nil
+}
+
+// Clear devuelve las actualizaciones que eliminan el código del documento (usar con firestore.MergeAll)
+func (f Fields) Clear() map[string]interface{} {
+	values := map[string]interface{}{
+		f.Hash:       firestore.Delete,
+		f.ValidUntil: firestore.Delete,
+		f.Attempts:   firestore.Delete,
+	}
+	if f.Legacy != "" {
+		values[f.Legacy] = firestore.Delete
+	}
+	return values
+}
+
+// Verify comprueba el código dentro de una transacción sobre ref, para que verificaciones concurrentes no
+// puedan consumir el mismo código ni saltarse el contador. Un código incorrecto suma un intento y, al
+// llegar a MaxAttempts, se invalida. Si el código coincide se llama a onMatch con los datos del documento;
+// sus actualizaciones se guardan junto con la eliminación del código. Si onMatch devuelve un error, no se
+// escribe nada y se devuelve ese error.
+func (f Fields) Verify(ctx context.Context, client *firestore.Client, ref *firestore.DocumentRef, uid, code string, onMatch func(data map[string]interface{}) (map[string]interface{}, error)) error {
+	var outcome error
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		outcome = nil
+
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		data := doc.Data()
+
+		attempts, _ := data[f.Attempts].(int64)
+		stored, _ := data[f.Hash].(string)
+		expected := f.hash(uid, code)
+		if legacy, _ := data[f.Legacy].(string); stored == "" && f.Legacy != "" && legacy != "" && attempts < MaxAttempts {
+			stored, expected = legacy, code
+		}
+		if stored == "" {
+			if attempts >= MaxAttempts {
+				outcome = ErrTooManyAttempts
+			} else {
+				outcome = ErrNoCode
+			}
+			return nil
+		}
+
+		validUntil, _ := data[f.ValidUntil].(time.Time)
+		if !time.Now().Before(validUntil) {
+			outcome = ErrExpired
+			return nil
+		}
+
+		if !hmac.Equal([]byte(stored), []byte(expected)) {
+			attempts++
+			updates := map[string]interface{}{f.Attempts: attempts}
+			outcome = ErrInvalidCode
+			if attempts >= MaxAttempts {
+				updates[f.Hash] = firestore.Delete
+				updates[f.ValidUntil] = firestore.Delete
+				if f.Legacy != "" {
+					updates[f.Legacy] = firestore.Delete
+				}
+				outcome = ErrTooManyAttempts
+			}
+			return tx.Set(ref, updates, firestore.MergeAll)
+		}
+
+		updates := f.Clear()
+		if onMatch != nil {
+			extra, err := onMatch(data)
+			if err != nil {
+				return err
+			}
+			for key, value := range extra {
+				updates[key] = value
+			}
+		}
+		return tx.Set(ref, updates, firestore.MergeAll)
+	})
+	if err != nil {
+		return err
+	}
+	return outcome
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
@@ -89,12 +90,25 @@ func main() {
 	// Configurar router Gin
 	r := gin.New()
 
+	// Solo se confía en X-Forwarded-For cuando la conexión viene de un proxy de TRUSTED_PROXIES (IPs o
+	// rangos CIDR separados por comas). Sin la variable, la IP del cliente es la de la conexión, para que
+	// no se pueda falsificar en los límites por IP, la auditoría ni la detección de dispositivos nuevos.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("TRUSTED_PROXIES inválido: %v", err)
+	}
+
 	// Middleware CORS
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Captcha-Token"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -116,6 +130,9 @@ func main() {
 	// Configurar rutas desde el paquete de autenticación (api)
 	api.SetupRouter(r, firestoreClient, authClient, storageClient)
 
+	// Iniciar las tareas en segundo plano (reintentos de eliminación de cuentas, etc.)
+	api.StartBackgroundJobs(context.Background(), firestoreClient, authClient, storageClient)
+
 	// Iniciar el servidor solo después de la inicialización completa
 	port := "8081"
 	if err := r.Run(":" + port); err != nil {